@@ -3,99 +3,111 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/metrics"
+	"github.com/greatfocus/archive-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Conn struct
 type Conn struct {
-	conn *sql.DB
+	conn       *sql.DB
+	migrations []migration
 }
 
 // Connect method make a database connection
 func (c *Conn) Connect() {
+	conn := open()
+
+	// apply pending migrations
+	c.migrate(conn)
+	c.conn = conn
+}
+
+// Rollback reverts the migrations applied after version, with their down scripts
+func (c *Conn) Rollback(version int) error {
+	conn := open()
+	defer func() {
+		_ = conn.Close()
+	}()
+	return rollback(conn, version)
+}
+
+// open connects to the database configured in the environment
+func open() *sql.DB {
 	// initialize variables rom config
-	log.Println("Preparing Database configuration")
+	slog.Info("preparing database configuration")
 	maxLifetimeVal, err := strconv.ParseUint(os.Getenv("DB_MaxLifetime"), 0, 64)
 	if err != nil {
-		log.Fatal(fmt.Println(err))
+		logging.Fatal("database setup failed", "err", err)
 	}
 	maxLifetime := time.Duration(maxLifetimeVal) * time.Minute
 
 	maxIdleConns, err := strconv.ParseInt(os.Getenv("DB_MaxIdleConns"), 0, 64)
 	if err != nil {
-		log.Fatal(fmt.Println(err))
+		logging.Fatal("database setup failed", "err", err)
 	}
 
 	maxOpenConns, err := strconv.ParseInt(os.Getenv("DB_MaxOpenConns"), 0, 64)
 	if err != nil {
-		log.Fatal(fmt.Println(err))
+		logging.Fatal("database setup failed", "err", err)
 	}
 
 	// create database connection
 	conn, err := sql.Open("sqlite3", "archive-service.db")
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("database setup failed", "err", err)
 	}
 	// confirm connection
 	err = conn.Ping()
 	if err != nil {
-		log.Fatal(fmt.Println(err))
+		logging.Fatal("database setup failed", "err", err)
 	}
 
 	conn.SetConnMaxLifetime(maxLifetime)
 	conn.SetMaxIdleConns(int(maxIdleConns))
 	conn.SetMaxOpenConns(int(maxOpenConns))
-	log.Println("Initiating Database connection")
+	slog.Info("initiating database connection")
+	return conn
+}
 
-	// execute database scripts
-	c.executeSchema(conn)
-	c.conn = conn
+// Ping checks the database answers
+func (c *Conn) Ping(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.New("database is not connected")
+	}
+	return c.conn.PingContext(ctx)
 }
 
-// ExecuteSchema prepare and execute database changes
-func (c *Conn) executeSchema(db *sql.DB) {
-	// read the scripts in the folder
-	var path = "./database/scripts/"
-	path = filepath.Clean(path)
-	log.Println("Preparing to execute database schema")
-	files, err := ioutil.ReadDir(path)
+// SchemaReady checks no migration of the build is pending
+func (c *Conn) SchemaReady(ctx context.Context) error {
+	pending, err := c.pendingMigrations(ctx)
 	if err != nil {
-		log.Fatal(fmt.Println(err))
-	}
-
-	// loop thru files to create schemas
-	for _, f := range files {
-		var schema = path + "/" + f.Name()
-		schemaPath := filepath.Clean(schema)
-		scriptFile, err := os.OpenFile(schemaPath, os.O_RDONLY, 0600)
-		if err != nil {
-			log.Fatal(fmt.Println(err))
-		}
-		// read the config file
-		scriptContent, err := ioutil.ReadAll(scriptFile)
-		if err != nil {
-			log.Fatal(fmt.Println(err))
-		}
-		sql := string(scriptContent)
-		log.Println("Executing schema: ", schemaPath)
-		if _, err := db.Exec(sql); err != nil {
-			log.Fatal(fmt.Println(err))
-		}
-	}
-
-	log.Println("Database scripts successfully executed")
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("migrations are pending: %s", strings.Join(pending, ", "))
+	}
+	return nil
 }
 
 // Insert method make a single row query to the databases
 func (c *Conn) Insert(ctx context.Context, query string, args ...interface{}) (int64, bool) {
+	defer metrics.ObserveQuery("insert", time.Now())
+	ctx, span := startSpan(ctx, "insert", query)
+	defer span.End()
 	stmt, err := c.conn.PrepareContext(ctx, query)
 	if err != nil {
+		tracing.Fail(span, err)
 		return 0, false
 	}
 	defer func() {
@@ -103,6 +115,7 @@ func (c *Conn) Insert(ctx context.Context, query string, args ...interface{}) (i
 	}()
 	res, err := stmt.ExecContext(ctx, args...)
 	if err != nil {
+		tracing.Fail(span, err)
 		return 0, false
 	}
 	rows, err := res.RowsAffected()
@@ -114,21 +127,31 @@ func (c *Conn) Insert(ctx context.Context, query string, args ...interface{}) (i
 
 // Query method make a resultset rows query to the databases
 func (c *Conn) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer metrics.ObserveQuery("query", time.Now())
+	ctx, span := startSpan(ctx, "query", query)
+	defer span.End()
 	stmt, err := c.conn.PrepareContext(ctx, query)
 	if err != nil {
+		tracing.Fail(span, err)
 		return &sql.Rows{}, err
 	}
 	defer func() {
 		_ = stmt.Close()
 	}()
 
-	return stmt.QueryContext(ctx, args...)
+	rows, err := stmt.QueryContext(ctx, args...)
+	tracing.Fail(span, err)
+	return rows, err
 }
 
 // Select method make a single row query to the databases
 func (c *Conn) Select(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer metrics.ObserveQuery("select", time.Now())
+	ctx, span := startSpan(ctx, "select", query)
+	defer span.End()
 	stmt, err := c.conn.PrepareContext(ctx, query)
 	if err != nil {
+		tracing.Fail(span, err)
 		return &sql.Row{}
 	}
 	defer func() {
@@ -140,18 +163,26 @@ func (c *Conn) Select(ctx context.Context, query string, args ...interface{}) *s
 
 // Update method executes update database changes to the databases
 func (c *Conn) Update(ctx context.Context, query string, args ...interface{}) bool {
+	defer metrics.ObserveQuery("update", time.Now())
+	ctx, span := startSpan(ctx, "update", query)
+	defer span.End()
 	return updateOrDelete(c, query, ctx, args)
 }
 
 // Delete method executes delete database changes to the databases
 func (c *Conn) Delete(ctx context.Context, query string, args ...interface{}) bool {
+	defer metrics.ObserveQuery("delete", time.Now())
+	ctx, span := startSpan(ctx, "delete", query)
+	defer span.End()
 	return updateOrDelete(c, query, ctx, args)
 }
 
 // update or delete records
 func updateOrDelete(c *Conn, query string, ctx context.Context, args []interface{}) bool {
+	span := trace.SpanFromContext(ctx)
 	stmt, err := c.conn.PrepareContext(ctx, query)
 	if err != nil {
+		tracing.Fail(span, err)
 		return false
 	}
 	defer func() {
@@ -159,6 +190,7 @@ func updateOrDelete(c *Conn, query string, ctx context.Context, args []interface
 	}()
 	res, err := stmt.ExecContext(ctx, args...)
 	if err != nil {
+		tracing.Fail(span, err)
 		return false
 	}
 
@@ -168,3 +200,12 @@ func updateOrDelete(c *Conn, query string, ctx context.Context, args []interface
 	}
 	return true
 }
+
+// startSpan begins the span of a database call, the statement is kept without its arguments
+func startSpan(ctx context.Context, operation string, query string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db."+operation,
+		attribute.String("db.system", "sqlite"),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", strings.Join(strings.Fields(query), " ")),
+	)
+}
@@ -0,0 +1,288 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/greatfocus/archive-service/logging"
+)
+
+// scripts holds the migrations, <version>_<name>.sql applies one and the optional
+// <version>_<name>.down.sql reverts it. Versions are consecutive numbers padded to three digits.
+//
+//go:embed scripts/*.sql
+var scripts embed.FS
+
+const downSuffix = ".down.sql"
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	appliedOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// migration is a versioned script of the schema
+type migration struct {
+	version  int
+	name     string
+	up       string
+	down     string
+	checksum string
+}
+
+// loadMigrations reads the embedded scripts ordered by version
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(scripts, "scripts/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "scripts/")
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", name)
+		}
+		content, err := scripts.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+		if strings.HasSuffix(name, downSuffix) {
+			m.down = string(content)
+			continue
+		}
+		if m.name != "" {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.name, name, version)
+		}
+		sum := sha256.Sum256(content)
+		m.name = name
+		m.up = string(content)
+		m.checksum = hex.EncodeToString(sum[:])
+	}
+
+	list := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.name == "" {
+			return nil, fmt.Errorf("down migration of version %d has no up migration", m.version)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// appliedMigrations returns the checksum of each applied version
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]string, error) {
+	rows, err := db.QueryContext(ctx, `select version, checksum from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = checksum
+	}
+	return applied, rows.Err()
+}
+
+// migrate applies the pending migrations in order, each once and in its own transaction.
+// It stops the process when an applied script was changed since.
+func (c *Conn) migrate(db *sql.DB) {
+	ctx := context.Background()
+	slog.Info("preparing to migrate database schema")
+	migrations, err := loadMigrations()
+	if err != nil {
+		logging.Fatal("database setup failed", "err", err)
+	}
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		logging.Fatal("database setup failed", "err", err)
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		logging.Fatal("database setup failed", "err", err)
+	}
+
+	// databases created before migrations were tracked re-ran every script on boot,
+	// their columns already exist the first time the scripts are recorded
+	legacy := false
+	if len(applied) == 0 {
+		var tables int
+		err := db.QueryRowContext(ctx, `select count(*) from sqlite_master where type = 'table' and name = 'archive'`).Scan(&tables)
+		if err != nil {
+			logging.Fatal("database setup failed", "err", err)
+		}
+		legacy = tables > 0
+		if legacy {
+			slog.Info("recording the migrations of an existing database")
+		}
+	}
+
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.version] = true
+		if checksum, ok := applied[m.version]; ok {
+			if checksum != m.checksum {
+				logging.Fatal("database setup failed", "err", fmt.Errorf("migration %s changed after it was applied", m.name))
+			}
+			continue
+		}
+		slog.Info("applying migration", "version", m.version, "script", m.name)
+		if err := applyMigration(ctx, db, m, legacy); err != nil {
+			logging.Fatal("database setup failed", "script", m.name, "err", err)
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			slog.Warn("database has a migration this build does not know", "version", version)
+		}
+	}
+
+	c.migrations = migrations
+	slog.Info("database schema is up to date")
+}
+
+// applyMigration runs the up script and records it in one transaction
+func applyMigration(ctx context.Context, db *sql.DB, m migration, legacy bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	script := m.up
+	if legacy {
+		if script, err = skipAppliedColumns(ctx, tx, script); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	query := `insert into schema_migrations (version, name, checksum) VALUES(?,?,?);`
+	if _, err := tx.ExecContext(ctx, query, m.version, m.name, m.checksum); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rollback reverts the applied migrations above version, newest first, each in its own transaction
+func rollback(db *sql.DB, version int) error {
+	ctx := context.Background()
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= version {
+			break
+		}
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+		if m.down == "" {
+			return fmt.Errorf("migration %s has no down migration", m.name)
+		}
+		slog.Info("reverting migration", "version", m.version, "script", m.name)
+		if err := revertMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("revert %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// revertMigration runs the down script and forgets the migration in one transaction
+func revertMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, m.down); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version=?;`, m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pendingMigrations returns the names of the known migrations not applied to the database
+func (c *Conn) pendingMigrations(ctx context.Context) ([]string, error) {
+	if c.conn == nil {
+		return nil, errors.New("database is not connected")
+	}
+	applied, err := appliedMigrations(ctx, c.conn)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, m := range c.migrations {
+		if _, ok := applied[m.version]; !ok {
+			pending = append(pending, m.name)
+		}
+	}
+	return pending, nil
+}
+
+// addColumn matches the ALTER statements the scripts used to re-run on every boot
+var addColumn = regexp.MustCompile(`(?i)ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(\w+)[^;]*;`)
+
+// skipAppliedColumns drops the ALTER statements adding a column the table already has,
+// the rest of the script runs as written
+func skipAppliedColumns(ctx context.Context, tx *sql.Tx, script string) (string, error) {
+	var err error
+	skipped := addColumn.ReplaceAllStringFunc(script, func(statement string) string {
+		match := addColumn.FindStringSubmatch(statement)
+		var exists int
+		query := `select count(*) from pragma_table_info(?) where name = ?`
+		if scanErr := tx.QueryRowContext(ctx, query, match[1], match[2]).Scan(&exists); scanErr != nil {
+			err = scanErr
+			return statement
+		}
+		if exists > 0 {
+			slog.Info("column already exists", "table", match[1], "column", match[2])
+			return ""
+		}
+		return statement
+	})
+	return skipped, err
+}
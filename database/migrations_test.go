@@ -0,0 +1,44 @@
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestMigrationsAreConsecutive(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("%s has version %d, want %d", m.name, m.version, i+1)
+		}
+		if prefix := fmt.Sprintf("%03d_", m.version); !strings.HasPrefix(m.name, prefix) {
+			t.Errorf("%s should start with %s", m.name, prefix)
+		}
+	}
+
+	files, err := fs.Glob(scripts, "scripts/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]string{}
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "scripts/")
+		prefix, _, _ := strings.Cut(name, "_")
+		key := prefix
+		if strings.HasSuffix(name, downSuffix) {
+			key += downSuffix
+		}
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s share version %s", other, name, prefix)
+		}
+		seen[key] = name
+	}
+}
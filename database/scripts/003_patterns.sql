@@ -0,0 +1,4 @@
+ALTER TABLE archive ADD COLUMN include TEXT NULL;
+ALTER TABLE archive ADD COLUMN exclude TEXT NULL;
+ALTER TABLE extract ADD COLUMN include TEXT NULL;
+ALTER TABLE extract ADD COLUMN exclude TEXT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE archive ADD COLUMN olderThan TEXT NOT NULL DEFAULT '';
+ALTER TABLE archive ADD COLUMN newerThan TEXT NOT NULL DEFAULT '';
+ALTER TABLE archive ADD COLUMN minSize INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE archive ADD COLUMN maxSize INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+ALTER TABLE archive ADD COLUMN sourceAction TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS archive_sources (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	archiveId VARCHAR(40) NOT NULL,
+	fileName TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	createdOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS archive_sources_archive ON archive_sources(archiveId);
@@ -0,0 +1,11 @@
+ALTER TABLE extract ADD COLUMN onConflict TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS extract_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	extractId VARCHAR(40) NOT NULL,
+	fileName TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	outcome TEXT NOT NULL,
+	createdOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS extract_entries_extract ON extract_entries(extractId);
@@ -0,0 +1,3 @@
+ALTER TABLE archive ADD COLUMN output TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN destination TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN stripComponents INTEGER NOT NULL DEFAULT 0;
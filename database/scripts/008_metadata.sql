@@ -0,0 +1 @@
+ALTER TABLE extract ADD COLUMN skipOwnership BOOLEAN NOT NULL DEFAULT 0 CHECK (skipOwnership IN (0, 1));
@@ -0,0 +1,2 @@
+ALTER TABLE archive ADD COLUMN reproducible BOOLEAN NOT NULL DEFAULT 0 CHECK (reproducible IN (0, 1));
+ALTER TABLE archive ADD COLUMN epoch INTEGER NOT NULL DEFAULT 0;
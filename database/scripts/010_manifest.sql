@@ -0,0 +1,12 @@
+ALTER TABLE archive ADD COLUMN manifest TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN verify BOOLEAN NOT NULL DEFAULT 0 CHECK (verify IN (0, 1));
+ALTER TABLE extract_entries ADD COLUMN verified TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS archive_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	archiveId VARCHAR(40) NOT NULL,
+	fileName TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	createdOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS archive_entries_archive ON archive_entries(archiveId);
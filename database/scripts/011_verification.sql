@@ -0,0 +1,15 @@
+ALTER TABLE archive ADD COLUMN integrity TEXT NOT NULL DEFAULT '';
+ALTER TABLE archive ADD COLUMN verifiedOn TIMESTAMP NULL;
+CREATE TABLE IF NOT EXISTS verification (
+	id VARCHAR(40) PRIMARY KEY,
+	archiveId VARCHAR(40) NOT NULL DEFAULT '',
+	fileName TEXT NOT NULL,
+	dir TEXT NOT NULL,
+	output TEXT NOT NULL DEFAULT '',
+	aligorithm TEXT NULL,
+	status TEXT NOT NULL,
+	integrity TEXT NOT NULL,
+	checked INTEGER NOT NULL,
+	failures TEXT NULL,
+	createdOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+ALTER TABLE archive ADD COLUMN signedBy TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN requireSignature BOOLEAN NOT NULL DEFAULT 0 CHECK (requireSignature IN (0, 1));
@@ -0,0 +1,2 @@
+ALTER TABLE archive ADD COLUMN passwordSecret TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN passwordSecret TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE archive ADD COLUMN encrypt BOOLEAN NOT NULL DEFAULT 0 CHECK (encrypt IN (0, 1));
+ALTER TABLE archive ADD COLUMN recipients TEXT;
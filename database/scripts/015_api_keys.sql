@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id VARCHAR(40) PRIMARY KEY,
+	name TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	revoked BOOLEAN NOT NULL DEFAULT 0 CHECK (revoked IN (0, 1)),
+	createdOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE archive ADD COLUMN keyId TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN keyId TEXT NOT NULL DEFAULT '';
+ALTER TABLE verification ADD COLUMN keyId TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+ALTER TABLE archive ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE archive ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE extract ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE verification ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS archive_tenant ON archive (tenant);
+CREATE INDEX IF NOT EXISTS extract_tenant ON extract (tenant);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS archive_key_status ON archive (keyId, status);
+CREATE INDEX IF NOT EXISTS extract_key_status ON extract (keyId, status);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	keyId TEXT NOT NULL,
+	idempotencyKey TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	jobId TEXT NOT NULL DEFAULT '',
+	createdOn TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (keyId, idempotencyKey)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE archive DROP COLUMN traceParent;
+ALTER TABLE extract DROP COLUMN traceParent;
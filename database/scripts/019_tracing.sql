@@ -0,0 +1,2 @@
+ALTER TABLE archive ADD COLUMN traceParent TEXT NOT NULL DEFAULT '';
+ALTER TABLE extract ADD COLUMN traceParent TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/services"
+)
+
+// APIKeys struct
+type APIKeys struct {
+	apiKeyService *services.APIKeyService
+}
+
+// ServeHTTP checks if is valid method
+func (k APIKeys) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		k.getKeys(w, r)
+		return
+	}
+	if r.Method == http.MethodPost {
+		k.createKey(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		k.revokeKey(w, r)
+		return
+	}
+
+	// catch all
+	// if no method is satisfied return an error
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Header().Add("Allow", "GET, POST, DELETE")
+}
+
+// Init method
+func (k *APIKeys) Init(APIKeyService *services.APIKeyService) {
+	k.apiKeyService = APIKeyService
+}
+
+// createKey issues a key and returns its token once
+func (k *APIKeys) createKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
+	defer cancel()
+
+	key := models.APIKey{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		payloadError(w, r, err)
+		return
+	}
+
+	err = json.Unmarshal(body, &key)
+	if err != nil {
+		derr := errors.New("invalid payload request")
+		w.WriteHeader(http.StatusBadRequest)
+		Error(w, r, derr)
+		return
+	}
+
+	// tenant admins only issue keys for their own tenant
+	if tenant := caller(r).Tenant; tenant != "" {
+		key.Tenant = tenant
+	}
+
+	err = key.Validate()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Error(w, r, err)
+		return
+	}
+
+	// with tenants configured a key without a tenant is a global admin
+	holder := models.Caller{Scopes: key.Scopes}
+	if os.Getenv("TENANTS_DIR") != "" && key.Tenant == "" && !holder.HasScope(models.ScopeAdmin) {
+		w.WriteHeader(http.StatusBadRequest)
+		Error(w, r, errors.New("tenant is required unless the key has the admin scope"))
+		return
+	}
+
+	res, err := k.apiKeyService.CreateKey(ctx, &key)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "create api key failed", "err", err)
+		Error(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, res)
+}
+
+// getKeys method
+func (k *APIKeys) getKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
+	defer cancel()
+
+	keys, err := k.apiKeyService.GetKeys(ctx, caller(r).Tenant)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list keys failed", "err", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Error(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, keys)
+}
+
+// revokeKey method
+func (k *APIKeys) revokeKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
+	defer cancel()
+
+	id := r.FormValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Error(w, r, errors.New("invalid payload request"))
+		return
+	}
+	if err := k.apiKeyService.RevokeKey(ctx, id, caller(r).Tenant); err != nil {
+		slog.ErrorContext(r.Context(), "revoke api key failed", "err", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Error(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, models.APIKey{ID: id, Revoked: true})
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -42,15 +42,13 @@ func (a *Archive) Init(ArchiveService *services.ArchiveService) {
 
 // create prepares Archive
 func (a *Archive) createArchive(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(1*time.Minute))
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
 	defer cancel()
 
 	req := models.Request{}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		derr := errors.New("invalid payload request")
-		w.WriteHeader(http.StatusBadRequest)
-		Error(w, r, derr)
+		payloadError(w, r, err)
 		return
 	}
 
@@ -61,6 +59,9 @@ func (a *Archive) createArchive(w http.ResponseWriter, r *http.Request) {
 		Error(w, r, derr)
 		return
 	}
+	req.KeyID = callerID(r)
+	req.Tenant = caller(r).Tenant
+	req.IdempotencyKey = r.Header.Get("Idempotency-Key")
 
 	err = req.Validate("archive")
 	if err != nil {
@@ -69,9 +70,17 @@ func (a *Archive) createArchive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = services.CheckRoots(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		Error(w, r, err)
+		return
+	}
+
 	res, err := a.archiveService.CreateArchive(ctx, &req)
 	if err != nil {
-		log.Printf("%s", err)
+		slog.ErrorContext(r.Context(), "create archive failed", "err", err)
+		errorStatus(w, err)
 		Error(w, r, err)
 		return
 	}
@@ -81,14 +90,14 @@ func (a *Archive) createArchive(w http.ResponseWriter, r *http.Request) {
 
 // getArchives method
 func (a *Archive) getStatus(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(1*time.Minute))
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
 	defer cancel()
 
 	id := r.FormValue("id")
 	if id != "" {
-		Archive, err := a.archiveService.GetStatus(ctx, id)
+		Archive, err := a.archiveService.GetStatus(ctx, id, caller(r).Tenant)
 		if err != nil {
-			log.Printf("%s", err)
+			slog.ErrorContext(r.Context(), "get status failed", "err", err)
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			Error(w, r, err)
 			return
@@ -124,6 +133,22 @@ func Error(w http.ResponseWriter, r *http.Request, err error) {
 	response(w, r, nil, "error")
 }
 
+// errorStatus sets the status of service errors callers can act on
+func errorStatus(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrTooManyJobs), errors.Is(err, services.ErrQueueFull):
+		// background jobs are picked up every minute
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	case errors.Is(err, services.ErrIdempotencyMismatch), errors.Is(err, services.ErrIdempotencyInProgress):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, services.ErrStorageQuota):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, services.ErrUnknownArchive):
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
 // response returns payload
 func response(w http.ResponseWriter, r *http.Request, data interface{}, message string) {
 	out, _ := json.Marshal(data)
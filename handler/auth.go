@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/services"
+)
+
+// apiKeyHeader carries the API key of the caller
+const apiKeyHeader = "X-API-Key"
+
+// Authentication modes selected with AUTH_MODE
+const (
+	authAPIKey = "apikey"
+	authJWT    = "jwt"
+	authBoth   = "both"
+)
+
+type contextKey string
+
+const callerKey contextKey = "caller"
+
+// Scopes maps request methods to the scope they require
+type Scopes map[string]string
+
+// Auth struct
+type Auth struct {
+	apiKeyService *services.APIKeyService
+	jwtService    *services.JWTService
+	mode          string
+	tenants       bool
+}
+
+// Init method
+func (a *Auth) Init(APIKeyService *services.APIKeyService, JWTService *services.JWTService) {
+	a.apiKeyService = APIKeyService
+	a.jwtService = JWTService
+	a.mode = strings.ToLower(os.Getenv("AUTH_MODE"))
+	switch a.mode {
+	case authAPIKey, authJWT, authBoth:
+	case "":
+		a.mode = authAPIKey
+	default:
+		logging.Fatal("AUTH_MODE must be " + authAPIKey + ", " + authJWT + " or " + authBoth)
+	}
+	a.tenants = os.Getenv("TENANTS_DIR") != ""
+}
+
+// Require authenticates the caller and checks the scope of the request method before calling next.
+// Methods missing from scopes fail closed and require the admin scope.
+func (a *Auth) Require(next http.Handler, scopes Scopes) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := scopes[r.Method]
+		if !ok {
+			scope = models.ScopeAdmin
+		}
+		caller, err := a.authenticate(r)
+		if err != nil {
+			if a.mode != authAPIKey {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			Error(w, r, err)
+			return
+		}
+		withClientCert(caller, r)
+		if !caller.CertAllowed() {
+			w.WriteHeader(http.StatusForbidden)
+			Error(w, r, errors.New("client certificate does not match the key"))
+			return
+		}
+		if caller.Tenant != "" && !models.ValidTenant(caller.Tenant) {
+			w.WriteHeader(http.StatusForbidden)
+			Error(w, r, errors.New("invalid tenant"))
+			return
+		}
+		// with tenants configured only admins act outside a tenant, they see every job and key and use ALLOWED_ROOTS
+		if a.tenants && caller.Tenant == "" && !caller.HasScope(models.ScopeAdmin) {
+			w.WriteHeader(http.StatusForbidden)
+			Error(w, r, errors.New("caller has no tenant"))
+			return
+		}
+		if !caller.HasScope(scope) {
+			w.WriteHeader(http.StatusForbidden)
+			Error(w, r, errors.New("caller lacks the "+scope+" scope"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey, caller)))
+	})
+}
+
+// authenticate uses the bearer token or the API key the mode allows
+func (a *Auth) authenticate(r *http.Request) (*models.Caller, error) {
+	if token, ok := bearerToken(r); ok && a.mode != authAPIKey {
+		caller, err := a.jwtService.Authenticate(r.Context(), token)
+		if err != nil {
+			slog.WarnContext(r.Context(), "bearer token rejected", "err", err)
+			return nil, services.ErrInvalidToken
+		}
+		return caller, nil
+	}
+	if a.mode == authJWT {
+		return nil, errors.New("bearer token required")
+	}
+	key, err := a.apiKeyService.Authenticate(r.Context(), r.Header.Get(apiKeyHeader))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidKey) {
+			slog.ErrorContext(r.Context(), "api key lookup failed", "err", err)
+		}
+		return nil, services.ErrInvalidKey
+	}
+	return &models.Caller{ID: key.ID, Tenant: key.Tenant, Scopes: key.Scopes, CertBinding: key.CertNames}, nil
+}
+
+// withClientCert exposes the verified client certificate to the certificate binding, scope checks and handlers
+func withClientCert(caller *models.Caller, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	caller.CertSubject = cert.Subject.CommonName
+	caller.CertNames = append(caller.CertNames, cert.DNSNames...)
+	caller.CertNames = append(caller.CertNames, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		caller.CertNames = append(caller.CertNames, uri.String())
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:]), true
+	}
+	return "", false
+}
+
+// caller returns the identity that authenticated the request
+func caller(r *http.Request) *models.Caller {
+	if c, ok := r.Context().Value(callerKey).(*models.Caller); ok {
+		return c
+	}
+	return &models.Caller{}
+}
+
+// callerID returns the id of the key or token subject that authenticated the request
+func callerID(r *http.Request) string {
+	return caller(r).ID
+}
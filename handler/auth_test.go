@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/services"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testAuth opens a fresh database in a temporary directory and returns the auth middleware over it
+func testAuth(t *testing.T) (*Auth, *services.APIKeyService) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	t.Setenv("DB_MaxLifetime", "1")
+	t.Setenv("DB_MaxIdleConns", "1")
+	t.Setenv("DB_MaxOpenConns", "1")
+	t.Setenv("AUTH_MODE", "")
+	t.Setenv("TENANTS_DIR", "")
+	db := &database.Conn{}
+	db.Connect()
+	keys := &services.APIKeyService{}
+	keys.Init(db)
+	auth := &Auth{}
+	auth.Init(keys, &services.JWTService{})
+	return auth, keys
+}
+
+// testClientCert returns a certificate as the TLS stack leaves it in VerifiedChains
+func testClientCert(t *testing.T, cn string, dnsNames ...string) *x509.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRequireClientCertificate(t *testing.T) {
+	auth, keys := testAuth(t)
+	key, err := keys.CreateKey(context.Background(), &models.APIKey{
+		Name:      "robot",
+		Scopes:    models.StringList{models.ScopeJobsRead},
+		CertNames: models.StringList{"robot.example"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen *models.Caller
+	h := auth.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = caller(r)
+	}), Scopes{http.MethodGet: models.ScopeJobsRead})
+
+	cases := []struct {
+		name   string
+		cert   *x509.Certificate
+		status int
+	}{
+		{"no certificate", nil, http.StatusForbidden},
+		{"other certificate", testClientCert(t, "intruder", "intruder.example"), http.StatusForbidden},
+		{"bound SAN", testClientCert(t, "robot", "robot.example"), http.StatusOK},
+		{"bound CN", testClientCert(t, "robot.example"), http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodGet, "/archive", nil)
+			req.Header.Set(apiKeyHeader, key.Token)
+			if c.cert != nil {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c.cert}}}
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, c.status, rec.Body.String())
+			}
+			if c.status != http.StatusOK {
+				if seen != nil {
+					t.Fatal("handler reached with a certificate the key is not bound to")
+				}
+				return
+			}
+			if seen == nil || seen.CertSubject != c.cert.Subject.CommonName {
+				t.Fatalf("caller %+v does not carry the certificate subject %q", seen, c.cert.Subject.CommonName)
+			}
+		})
+	}
+}
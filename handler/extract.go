@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -42,15 +42,13 @@ func (f *Extract) Init(ExtractService *services.ExtractService) {
 
 // create prepares Extract
 func (f *Extract) createExtract(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(1*time.Minute))
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
 	defer cancel()
 
 	req := models.Request{}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		derr := errors.New("invalid payload request")
-		w.WriteHeader(http.StatusBadRequest)
-		Error(w, r, derr)
+		payloadError(w, r, err)
 		return
 	}
 
@@ -61,6 +59,9 @@ func (f *Extract) createExtract(w http.ResponseWriter, r *http.Request) {
 		Error(w, r, derr)
 		return
 	}
+	req.KeyID = callerID(r)
+	req.Tenant = caller(r).Tenant
+	req.IdempotencyKey = r.Header.Get("Idempotency-Key")
 
 	err = req.Validate("extract")
 	if err != nil {
@@ -69,9 +70,17 @@ func (f *Extract) createExtract(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = services.CheckRoots(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		Error(w, r, err)
+		return
+	}
+
 	res, err := f.extractService.CreateExtract(ctx, &req)
 	if err != nil {
-		log.Printf("%s", err)
+		slog.ErrorContext(r.Context(), "create extract failed", "err", err)
+		errorStatus(w, err)
 		Error(w, r, err)
 		return
 	}
@@ -81,14 +90,14 @@ func (f *Extract) createExtract(w http.ResponseWriter, r *http.Request) {
 
 // getExtracts method
 func (f *Extract) getStatus(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(1*time.Minute))
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
 	defer cancel()
 
 	id := r.FormValue("id")
 	if id != "" {
-		Extract, err := f.extractService.GetStatus(ctx, id)
+		Extract, err := f.extractService.GetStatus(ctx, id, caller(r).Tenant)
 		if err != nil {
-			log.Printf("%s", err)
+			slog.ErrorContext(r.Context(), "get status failed", "err", err)
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			Error(w, r, err)
 			return
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/greatfocus/archive-service/services"
+)
+
+// Live struct
+type Live struct{}
+
+// ServeHTTP answers while the process serves requests
+func (l Live) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, struct {
+		Status string `json:"status"`
+	}{Status: "ok"})
+}
+
+// Ready struct
+type Ready struct {
+	healthService *services.HealthService
+}
+
+// Init method
+func (re *Ready) Init(HealthService *services.HealthService) {
+	re.healthService = HealthService
+}
+
+// ServeHTTP answers 503 until the database, schema, storage and scheduler checks pass
+func (re Ready) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	checks, ready := re.healthService.Ready(ctx)
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	Success(w, r, checks)
+}
+
+// Status struct
+type Status struct {
+	healthService *services.HealthService
+}
+
+// Init method
+func (s *Status) Init(HealthService *services.HealthService) {
+	s.healthService = HealthService
+}
+
+// ServeHTTP checks if is valid method
+func (s Status) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.getStatus(w, r)
+		return
+	}
+
+	// catch all
+	// if no method is satisfied return an error
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Header().Add("Allow", "GET")
+}
+
+// getStatus reports the build, uptime, queue depths and scheduler runs
+func (s *Status) getStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	status, err := s.healthService.Status(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "get service status failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		Error(w, r, errors.New("failed to read the service status"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, status)
+}
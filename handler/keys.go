@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/greatfocus/archive-service/services"
+)
+
+// Keys struct
+type Keys struct {
+	keyService *services.KeyService
+}
+
+// ServeHTTP checks if is valid method
+func (k Keys) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		k.getKeys(w, r)
+		return
+	}
+
+	// catch all
+	// if no method is satisfied return an error
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Header().Add("Allow", "GET")
+}
+
+// Init method
+func (k *Keys) Init(KeyService *services.KeyService) {
+	k.keyService = KeyService
+}
+
+// getKeys method
+func (k *Keys) getKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := k.keyService.GetKeys()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list signing keys failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		Error(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, keys)
+}
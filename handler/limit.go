@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxBody is the request body limit when MAX_BODY_BYTES is not set
+const defaultMaxBody = 1 << 20
+
+// bucketIdle is how long an unused bucket is kept before it is dropped
+const bucketIdle = 10 * time.Minute
+
+// rate is a token bucket refilled at perSecond up to burst tokens
+type rate struct {
+	perSecond float64
+	burst     float64
+}
+
+type bucket struct {
+	tokens    float64
+	updatedOn time.Time
+}
+
+// Limiter rate limits clients with one token bucket for creates and one for reads, and bounds request bodies.
+// Each remote IP also has a bucket checked before authentication.
+type Limiter struct {
+	create  rate
+	read    rate
+	perIP   rate
+	maxBody int64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweptOn time.Time
+}
+
+// Init method
+func (l *Limiter) Init() {
+	l.create = envRate("RATE_LIMIT_CREATE")
+	l.read = envRate("RATE_LIMIT_READ")
+	l.perIP = envRate("RATE_LIMIT_IP")
+	l.maxBody = defaultMaxBody
+	if value, err := strconv.ParseInt(os.Getenv("MAX_BODY_BYTES"), 10, 64); err == nil && value > 0 {
+		l.maxBody = value
+	}
+	l.buckets = map[string]*bucket{}
+}
+
+// Limit refuses clients out of tokens with 429 and caps the body before calling next
+func (l *Limiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, kind := l.read, "read"
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			limit, kind = l.create, "create"
+		}
+		if wait := l.take(kind+":"+clientID(r), limit); wait > 0 {
+			tooManyRequests(w, r, wait)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, l.maxBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitIP refuses remote IPs out of tokens with 429, it wraps authentication so failed attempts are limited too
+func (l *Limiter) LimitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.take("ip:"+remoteIP(r), l.perIP); wait > 0 {
+			tooManyRequests(w, r, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tooManyRequests answers 429 with the seconds to wait before the next token
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	Error(w, r, errors.New("rate limit exceeded"))
+}
+
+// take spends a token of the client and returns how long to wait when there is none left
+func (l *Limiter) take(key string, limit rate) time.Duration {
+	if limit.perSecond <= 0 {
+		return 0
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst, updatedOn: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(limit.burst, b.tokens+now.Sub(b.updatedOn).Seconds()*limit.perSecond)
+	b.updatedOn = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / limit.perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep drops the buckets of clients that have been idle, they would be full again anyway
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.sweptOn) < time.Minute {
+		return
+	}
+	l.sweptOn = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updatedOn) > bucketIdle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientID keys the limits by the authenticated caller, or the remote address of anonymous requests
+func clientID(r *http.Request) string {
+	if id := callerID(r); id != "" {
+		return id
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns the host of the remote address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// envRate reads a limit in requests per minute, the burst defaults to the same number
+func envRate(key string) rate {
+	perMinute, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || perMinute <= 0 {
+		return rate{}
+	}
+	burst, err := strconv.ParseFloat(os.Getenv(key+"_BURST"), 64)
+	if err != nil || burst < 1 {
+		burst = perMinute
+	}
+	return rate{perSecond: perMinute / 60, burst: burst}
+}
+
+// payloadError rejects unreadable bodies, with 413 when over MAX_BODY_BYTES
+func payloadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		Error(w, r, errors.New("payload too large"))
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	Error(w, r, errors.New("invalid payload request"))
+}
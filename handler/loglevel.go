@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+
+	"github.com/greatfocus/archive-service/logging"
+)
+
+// LogLevel struct
+type LogLevel struct{}
+
+// logLevel is the body of the log level endpoint
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// ServeHTTP checks if is valid method
+func (l LogLevel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.WriteHeader(http.StatusOK)
+		Success(w, r, logLevel{Level: logging.Level()})
+		return
+	}
+	if r.Method == http.MethodPut {
+		l.setLevel(w, r)
+		return
+	}
+
+	// catch all
+	// if no method is satisfied return an error
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Header().Add("Allow", "GET, PUT")
+}
+
+// setLevel changes the log level without a restart
+func (l *LogLevel) setLevel(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		payloadError(w, r, err)
+		return
+	}
+	req := logLevel{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		payloadError(w, r, err)
+		return
+	}
+	if err := logging.SetLevel(req.Level); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Error(w, r, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "log level changed", "level", logging.Level(), "caller", callerID(r))
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, logLevel{Level: logging.Level()})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/services"
+)
+
+// Verify struct
+type Verify struct {
+	verifyService *services.VerifyService
+}
+
+// ServeHTTP checks if is valid method
+func (v Verify) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		v.getStatus(w, r)
+		return
+	}
+	if r.Method == http.MethodPost {
+		v.createVerify(w, r)
+		return
+	}
+
+	// catch all
+	// if no method is satisfied return an error
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Header().Add("Allow", "GET, POST")
+}
+
+// Init method
+func (v *Verify) Init(VerifyService *services.VerifyService) {
+	v.verifyService = VerifyService
+}
+
+// create prepares Verify
+func (v *Verify) createVerify(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
+	defer cancel()
+
+	req := models.Request{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		payloadError(w, r, err)
+		return
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		derr := errors.New("invalid payload request")
+		w.WriteHeader(http.StatusBadRequest)
+		Error(w, r, derr)
+		return
+	}
+	req.KeyID = callerID(r)
+	req.Tenant = caller(r).Tenant
+
+	err = req.Validate("verify")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Error(w, r, err)
+		return
+	}
+
+	err = services.CheckRoots(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		Error(w, r, err)
+		return
+	}
+
+	res, err := v.verifyService.CreateVerify(ctx, &req)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "create verification failed", "err", err)
+		errorStatus(w, err)
+		Error(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	Success(w, r, res)
+}
+
+// getStatus method
+func (v *Verify) getStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(r.Context()), time.Now().Add(1*time.Minute))
+	defer cancel()
+
+	id := r.FormValue("id")
+	if id != "" {
+		Verify, err := v.verifyService.GetStatus(ctx, id, caller(r).Tenant)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "get status failed", "err", err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Error(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		Success(w, r, Verify)
+		return
+	}
+
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	Error(w, r, errors.New("invalid payload request"))
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/greatfocus/archive-service/tracing"
+)
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "requestId"
+	jobIDKey     contextKey = "jobId"
+)
+
+// level can be changed while the service runs
+var level = new(slog.LevelVar)
+
+// Init installs the JSON logger as the default at LOG_LEVEL, lines logged with a context carry its request, job and trace ids
+func Init() {
+	if err := SetLevel(os.Getenv("LOG_LEVEL")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// SetLevel changes the level to debug, info, warn or error, info when empty
+func SetLevel(name string) error {
+	if name == "" {
+		level.Set(slog.LevelInfo)
+		return nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("log level must be debug, info, warn or error")
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level returns the current level name
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// Fatal logs the error and stops the process
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// WithRequestID returns a context whose log lines carry the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// WithJobID returns a context whose log lines carry the job id
+func WithJobID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, jobIDKey, id)
+}
+
+// Logger returns the default logger with the ids of the context, for code that logs without a context
+func Logger(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	for _, attr := range attrs(ctx) {
+		logger = logger.With(attr)
+	}
+	return logger
+}
+
+func attrs(ctx context.Context) []slog.Attr {
+	var list []slog.Attr
+	if id, _ := ctx.Value(requestIDKey).(string); id != "" {
+		list = append(list, slog.String("request_id", id))
+	}
+	if id, _ := ctx.Value(jobIDKey).(string); id != "" {
+		list = append(list, slog.String("job_id", id))
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		list = append(list, slog.String("trace_id", id))
+	}
+	return list
+}
+
+// contextHandler adds the request, job and trace ids of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		r.AddAttrs(attrs(ctx)...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
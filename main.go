@@ -1,25 +1,46 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/logging"
 	"github.com/greatfocus/archive-service/router"
 	"github.com/greatfocus/archive-service/task"
+	"github.com/greatfocus/archive-service/tracing"
 	gfcron "github.com/greatfocus/gf-cron"
 	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	rollback := flag.Int("rollback", -1, "revert the migrations applied after this version and exit")
+	flag.Parse()
+
 	// Load environment variables
 	if err := godotenv.Load(".env"); err != nil {
-		log.Fatal(err)
+		logging.Fatal("failed to load .env", "err", err)
+	}
+	logging.Init()
+	if *rollback >= 0 {
+		var db = database.Conn{}
+		if err := db.Rollback(*rollback); err != nil {
+			logging.Fatal("rollback failed", "err", err)
+		}
+		slog.Info("rollback finished", "version", *rollback)
+		return
+	}
+	flush, err := tracing.Init(context.Background())
+	if err != nil {
+		logging.Fatal("invalid tracing configuration", "err", err)
 	}
 
 	// initialize services
@@ -31,16 +52,35 @@ func main() {
 	tasks.Init(&db)
 	gfcron.New().MustAddJob("* * * * *", tasks.ExtractBackgroundFile)
 	gfcron.New().MustAddJob("* * * * *", tasks.ArchiveBackgroundFile)
+	if schedule := os.Getenv("VERIFY_SCHEDULE"); schedule != "" {
+		gfcron.New().MustAddJob(schedule, tasks.VerifyArchives)
+	}
 
-	mux := router.LoadRouter(&db)
+	mux := router.LoadRouter(&db, &tasks)
 	serve(mux)
+
+	// spans still batched are exported before the process stops
+	if flush != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := flush(ctx); err != nil {
+			slog.Error("failed to flush traces", "err", err)
+		}
+	}
+	slog.Info("server stopped")
 }
 
-// serve creates server instance
+// serve creates server instance and returns once it was shut down on SIGINT or SIGTERM,
+// after the requests in flight completed or SERVER_TIMEOUT passed
 func serve(mux *http.ServeMux) {
 	timeout, err := strconv.ParseUint(os.Getenv("SERVER_TIMEOUT"), 0, 64)
 	if err != nil {
-		log.Fatal(fmt.Println(err))
+		logging.Fatal("SERVER_TIMEOUT must be a number of seconds", "err", err)
+	}
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		logging.Fatal("invalid TLS configuration", "err", err)
 	}
 
 	addr := ":" + os.Getenv("SERVER_PORT")
@@ -50,7 +90,32 @@ func serve(mux *http.ServeMux) {
 		WriteTimeout:   time.Duration(timeout) * time.Second,
 		MaxHeaderBytes: 1 << 20,
 		Handler:        mux,
+		TLSConfig:      tlsConfig,
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	failed := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			slog.Info("listening for HTTPS", "addr", addr)
+			failed <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		slog.Info("listening for HTTP", "addr", addr)
+		failed <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-failed:
+		logging.Fatal("server stopped", "err", err)
+	case sig := <-stop:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+	signal.Stop(stop)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("graceful shutdown failed", "err", err)
 	}
-	log.Println("Listening to port HTTP", addr)
-	log.Fatal(srv.ListenAndServe())
 }
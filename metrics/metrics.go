@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace prefixes every metric of the service
+const namespace = "archive_service"
+
+var (
+	jobsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_created_total",
+		Help:      "Jobs created by type and format.",
+	}, []string{"type", "format"})
+
+	jobsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_completed_total",
+		Help:      "Jobs that ran to completion by type and format.",
+	}, []string{"type", "format"})
+
+	jobsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_failed_total",
+		Help:      "Jobs that failed by type and format.",
+	}, []string{"type", "format"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time spent running jobs by type and format.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"type", "format"})
+
+	bytesRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_read_total",
+		Help:      "Bytes read by jobs by type.",
+	}, []string{"type"})
+
+	bytesWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_written_total",
+		Help:      "Bytes written by jobs by type.",
+	}, []string{"type"})
+
+	workersBusy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_busy",
+		Help:      "Job slots in use by tenant.",
+	}, []string{"tenant"})
+
+	workersMax = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_max",
+		Help:      "Job slots available to the tenant, 0 when unlimited.",
+	}, []string{"tenant"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation.",
+		Buckets:   []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+	}, []string{"operation"})
+)
+
+// JobCreated counts a new job
+func JobCreated(kind, format string) {
+	jobsCreated.WithLabelValues(kind, format).Inc()
+}
+
+// JobFinished counts the outcome of a job and observes how long it ran
+func JobFinished(kind, format string, start time.Time, err error) {
+	jobDuration.WithLabelValues(kind, format).Observe(time.Since(start).Seconds())
+	if err != nil {
+		jobsFailed.WithLabelValues(kind, format).Inc()
+		return
+	}
+	jobsCompleted.WithLabelValues(kind, format).Inc()
+}
+
+// Transferred counts the bytes a job read and wrote
+func Transferred(kind string, read, written int64) {
+	bytesRead.WithLabelValues(kind).Add(float64(read))
+	bytesWritten.WithLabelValues(kind).Add(float64(written))
+}
+
+// WorkersMax records the job slots of each tenant
+func WorkersMax(tenant string, limit int64) {
+	workersMax.WithLabelValues(tenant).Set(float64(limit))
+}
+
+// WorkerBusy tracks the job slots held by the tenant, delta is 1 on acquire and -1 on release
+func WorkerBusy(tenant string, delta float64) {
+	workersBusy.WithLabelValues(tenant).Add(delta)
+}
+
+// ObserveRequest records the latency of an HTTP request
+func ObserveRequest(route, method string, code int, start time.Time) {
+	httpDuration.WithLabelValues(route, method, strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveQuery records the latency of a database operation
+func ObserveQuery(operation string, start time.Time) {
+	dbDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// queueDepth is read from the database on every scrape
+var queueDepth = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "jobs"),
+	"Jobs by type and status.",
+	[]string{"type", "status"}, nil,
+)
+
+// QueueCounter returns the number of jobs by type and status
+type QueueCounter func() ([]models.JobCount, error)
+
+type queueCollector struct {
+	count QueueCounter
+}
+
+// RegisterQueue exposes the jobs counted by count
+func RegisterQueue(count QueueCounter) {
+	prometheus.MustRegister(queueCollector{count: count})
+}
+
+func (c queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepth
+}
+
+func (c queueCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.count()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(queueDepth, err)
+		return
+	}
+	for _, c := range counts {
+		ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(c.Jobs), c.Type, c.Status)
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseCutoff converts an age such as "7d" or "12h", or an RFC3339 timestamp, into a point in time
+func ParseCutoff(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseUint(strings.TrimSuffix(value, "d"), 10, 32)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid age %s", value)
+		}
+		return now.AddDate(0, 0, -int(days)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid age %s", value)
+	}
+	return now.Add(-d), nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Scopes granted to API keys
+const (
+	ScopeArchiveWrite = "archive:write"
+	ScopeExtractWrite = "extract:write"
+	ScopeJobsRead     = "jobs:read"
+	ScopeMetricsRead  = "metrics:read"
+	ScopeAdmin        = "admin"
+)
+
+// APIKey is a credential callers authenticate with, the token is only returned when the key is created.
+// A key with certNames is only accepted with a verified client certificate whose CN or a SAN is one of them
+type APIKey struct {
+	ID        string     `json:"id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Tenant    string     `json:"tenant,omitempty"`
+	Scopes    StringList `json:"scopes,omitempty"`
+	CertNames StringList `json:"certNames,omitempty"`
+	Token     string     `json:"token,omitempty"`
+	Revoked   bool       `json:"revoked,omitempty"`
+	CreatedOn *time.Time `json:"createdOn,omitempty"`
+}
+
+// Validate check if the key can be created
+func (k *APIKey) Validate() error {
+	if k.Name == "" {
+		return errors.New("name is required")
+	}
+	if k.Tenant != "" && !ValidTenant(k.Tenant) {
+		return errors.New("tenant must be letters, digits, dots, dashes or underscores")
+	}
+	if len(k.Scopes) == 0 {
+		return errors.New("scopes are required")
+	}
+	for _, name := range k.CertNames {
+		if name == "" {
+			return errors.New("certNames must not be empty")
+		}
+	}
+	for _, scope := range k.Scopes {
+		switch scope {
+		case ScopeArchiveWrite, ScopeExtractWrite, ScopeJobsRead, ScopeMetricsRead, ScopeAdmin:
+		default:
+			return errors.New("scopes must be archive:write, extract:write, jobs:read, metrics:read or admin")
+		}
+	}
+	return nil
+}
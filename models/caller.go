@@ -0,0 +1,41 @@
+package models
+
+// Caller is the authenticated identity behind a request
+type Caller struct {
+	ID     string     `json:"id,omitempty"`
+	Tenant string     `json:"tenant,omitempty"`
+	Scopes StringList `json:"scopes,omitempty"`
+	// CertSubject and CertNames identify the verified client certificate over mutual TLS
+	CertSubject string     `json:"certSubject,omitempty"`
+	CertNames   StringList `json:"certNames,omitempty"`
+	// CertBinding lists the certificate names the credential is bound to, empty when it is not bound
+	CertBinding StringList `json:"-"`
+}
+
+// CertAllowed check if the verified client certificate is one the credential is bound to
+func (c *Caller) CertAllowed() bool {
+	if len(c.CertBinding) == 0 {
+		return true
+	}
+	for _, bound := range c.CertBinding {
+		if bound == c.CertSubject && c.CertSubject != "" {
+			return true
+		}
+		for _, name := range c.CertNames {
+			if bound == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasScope check if the caller was granted the scope, admin grants every scope
+func (c *Caller) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Outcomes of extracted entries
+const (
+	OutcomeCreated     = "created"
+	OutcomeOverwritten = "overwritten"
+	OutcomeSkipped     = "skipped"
+	OutcomeRenamed     = "renamed"
+)
+
+// Results of checking an extracted file against the manifest
+const (
+	VerifiedOK       = "ok"
+	VerifiedMismatch = "mismatch"
+	VerifiedUnlisted = "unlisted"
+)
+
+// File describes a file selected by a request
+type File struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Action    string `json:"action,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+	Verified  string `json:"verified,omitempty"`
+	// ModTime is the modification time of the file when it was archived
+	ModTime time.Time `json:"-"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Check is the outcome of a readiness check
+type Check struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+}
+
+// Status describes the running service
+type Status struct {
+	Version   string               `json:"version"`
+	Revision  string               `json:"revision,omitempty"`
+	GoVersion string               `json:"goVersion"`
+	StartedOn time.Time            `json:"startedOn"`
+	Uptime    string               `json:"uptime"`
+	Jobs      []JobCount           `json:"jobs"`
+	LastRuns  map[string]time.Time `json:"lastRuns"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// JobCount is the number of jobs of a type in a status
+type JobCount struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Jobs   int64  `json:"jobs"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// Key describes a public key archive signatures can be checked with
+type Key struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// StringList is a list of strings persisted as a JSON array
+type StringList []string
+
+// Value encodes the list for the database
+func (l StringList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	out, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
+
+// Scan decodes the list from the database
+func (l *StringList) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		return l.decode([]byte(v))
+	case []byte:
+		return l.decode(v)
+	default:
+		return errors.New("invalid string list value")
+	}
+}
+
+func (l *StringList) decode(data []byte) error {
+	if len(data) == 0 {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
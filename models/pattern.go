@@ -0,0 +1,42 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// regexPrefix marks a pattern as a regular expression instead of a glob
+const regexPrefix = "re:"
+
+// Pattern matches slash separated paths against a glob or a regex
+type Pattern struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+// CompilePattern prepares a doublestar glob, or a regex when prefixed with "re:"
+func CompilePattern(p string) (Pattern, error) {
+	if strings.HasPrefix(p, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(p, regexPrefix))
+		if err != nil {
+			return Pattern{}, fmt.Errorf("invalid pattern %s: %s", p, err)
+		}
+		return Pattern{regex: re}, nil
+	}
+	if p == "" || !doublestar.ValidatePattern(p) {
+		return Pattern{}, fmt.Errorf("invalid pattern %s", p)
+	}
+	return Pattern{glob: p}, nil
+}
+
+// Match check if the path satisfies the pattern
+func (p Pattern) Match(name string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(name)
+	}
+	matched, _ := doublestar.Match(p.glob, name)
+	return matched
+}
@@ -2,25 +2,98 @@ package models
 
 import (
 	"errors"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
+// Source actions applied to archived files
+const (
+	SourceKeep     = "keep"
+	SourceDelete   = "delete"
+	SourceTruncate = "truncate"
+	// SourceChanged marks a file left in place because it changed after it was archived
+	SourceChanged = "changed"
+)
+
+// Conflict policies for extracted files that already exist
+const (
+	ConflictOverwrite = "overwrite"
+	ConflictSkip      = "skip"
+	ConflictRename    = "rename"
+	ConflictFail      = "fail"
+	ConflictNewer     = "newer"
+)
+
+// Archive formats selected by the aligorithm field
+const (
+	FormatZip = "zip"
+	FormatTar = "tar"
+)
+
+// Manifest locations for per-entry sha256 digests
+const (
+	ManifestEntry   = "entry"
+	ManifestSidecar = "sidecar"
+)
+
+// Integrity results of an archive verification
+const (
+	IntegrityOK      = "ok"
+	IntegrityCorrupt = "corrupt"
+)
+
 // Request struct
 type Request struct {
-	ID                string    `json:"id,omitempty"`
-	File              string    `json:"file,omitempty"`
-	Dir               string    `json:"dir,omitempty"`
-	Status            string    `json:"status,omitempty"`
-	FilteredNames     string    `json:"filteredNames,omitempty"`
-	Aligorithm        string    `json:"aligorithm,omitempty"`
-	PartialExtraction string    `json:"partialExtraction,omitempty"`
-	Background        bool      `json:"background,omitempty"`
-	CreatedOn         time.Time `json:"-"`
+	ID                string     `json:"id,omitempty"`
+	File              string     `json:"file,omitempty"`
+	Dir               string     `json:"dir,omitempty"`
+	Destination       string     `json:"destination,omitempty"`
+	Output            string     `json:"output,omitempty"`
+	StripComponents   int        `json:"stripComponents,omitempty"`
+	Status            string     `json:"status,omitempty"`
+	FilteredNames     string     `json:"filteredNames,omitempty"`
+	Include           StringList `json:"include,omitempty"`
+	Exclude           StringList `json:"exclude,omitempty"`
+	OlderThan         string     `json:"olderThan,omitempty"`
+	NewerThan         string     `json:"newerThan,omitempty"`
+	MinSize           int64      `json:"minSize,omitempty"`
+	MaxSize           int64      `json:"maxSize,omitempty"`
+	SourceAction      string     `json:"sourceAction,omitempty"`
+	Reproducible      bool       `json:"reproducible,omitempty"`
+	Epoch             int64      `json:"epoch,omitempty"`
+	Manifest          string     `json:"manifest,omitempty"`
+	Verify            bool       `json:"verify,omitempty"`
+	RequireSignature  bool       `json:"requireSignature,omitempty"`
+	PasswordSecret    string     `json:"passwordSecret,omitempty"`
+	Encrypt           bool       `json:"encrypt,omitempty"`
+	Recipients        StringList `json:"recipients,omitempty"`
+	SignedBy          string     `json:"signedBy,omitempty"`
+	OnConflict        string     `json:"onConflict,omitempty"`
+	SkipOwnership     bool       `json:"skipOwnership,omitempty"`
+	DryRun            bool       `json:"dryRun,omitempty"`
+	Files             []File     `json:"files,omitempty"`
+	EstimatedSize     int64      `json:"estimatedSize,omitempty"`
+	ArchiveID         string     `json:"archiveId,omitempty"`
+	Integrity         string     `json:"integrity,omitempty"`
+	Checked           int        `json:"checked,omitempty"`
+	Failures          StringList `json:"failures,omitempty"`
+	Aligorithm        string     `json:"aligorithm,omitempty"`
+	PartialExtraction string     `json:"partialExtraction,omitempty"`
+	Background        bool       `json:"background,omitempty"`
+	KeyID             string     `json:"keyId,omitempty"`
+	Tenant            string     `json:"tenant,omitempty"`
+	Size              int64      `json:"size,omitempty"`
+	IdempotencyKey    string     `json:"-"`
+	TraceParent       string     `json:"-"`
+	CreatedOn         time.Time  `json:"-"`
 }
 
 // Validate check if request is valid
 func (r *Request) Validate(action string) error {
+	if len(r.IdempotencyKey) > 255 {
+		return errors.New("Idempotency-Key must be at most 255 characters")
+	}
 	switch strings.ToLower(action) {
 	case "archive":
 		if r.File == "" {
@@ -29,7 +102,32 @@ func (r *Request) Validate(action string) error {
 		if r.Dir == "" {
 			return errors.New("dir is required")
 		}
-		return nil
+		if err := r.validateFormat(); err != nil {
+			return err
+		}
+		if err := r.validateCriteria(); err != nil {
+			return err
+		}
+		switch r.Manifest {
+		case "", ManifestEntry, ManifestSidecar:
+		default:
+			return errors.New("manifest must be entry or sidecar")
+		}
+		switch r.SourceAction {
+		case "", SourceKeep, SourceDelete, SourceTruncate:
+		default:
+			return errors.New("sourceAction must be keep, delete or truncate")
+		}
+		if err := r.validatePassword(); err != nil {
+			return err
+		}
+		if (r.PasswordSecret != "" || r.Encrypt) && r.Reproducible {
+			return errors.New("encrypted archives cannot be reproducible")
+		}
+		if r.Encrypt && r.Manifest == ManifestSidecar {
+			return errors.New("encrypted archives must keep the manifest as an entry")
+		}
+		return r.validatePatterns()
 	case "extract":
 		if r.File == "" {
 			return errors.New("file is required")
@@ -37,7 +135,32 @@ func (r *Request) Validate(action string) error {
 		if r.Dir == "" {
 			return errors.New("dir is required")
 		}
-		return nil
+		if err := r.validateFormat(); err != nil {
+			return err
+		}
+		if r.StripComponents < 0 {
+			return errors.New("stripComponents must not be negative")
+		}
+		switch r.OnConflict {
+		case "", ConflictOverwrite, ConflictSkip, ConflictRename, ConflictFail, ConflictNewer:
+		default:
+			return errors.New("onConflict must be overwrite, skip, rename, fail or newer")
+		}
+		if err := r.validatePassword(); err != nil {
+			return err
+		}
+		return r.validatePatterns()
+	case "verify":
+		if r.File == "" {
+			return errors.New("file is required")
+		}
+		if r.Dir == "" {
+			return errors.New("dir is required")
+		}
+		if err := r.validateFormat(); err != nil {
+			return err
+		}
+		return r.validatePassword()
 	case "get":
 		if r.ID == "" {
 			return errors.New("id is required")
@@ -48,6 +171,92 @@ func (r *Request) Validate(action string) error {
 	}
 }
 
+// validatePatterns check if include and exclude patterns compile
+func (r *Request) validatePatterns() error {
+	for _, list := range []StringList{r.Include, r.Exclude} {
+		for _, p := range list {
+			if _, err := CompilePattern(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateFormat check if the archive format is supported
+func (r *Request) validateFormat() error {
+	switch strings.ToLower(r.Aligorithm) {
+	case "", FormatZip, FormatTar:
+		return nil
+	default:
+		return errors.New("aligorithm must be zip or tar")
+	}
+}
+
+// validatePassword check if the password secret is usable with the archive format
+func (r *Request) validatePassword() error {
+	if r.PasswordSecret == "" {
+		return nil
+	}
+	if !ValidSecretID(r.PasswordSecret) {
+		return errors.New("passwordSecret must be a secret id")
+	}
+	if r.Format() != FormatZip {
+		return errors.New("passwords are only supported for zip archives")
+	}
+	return nil
+}
+
+// Format returns the archive format from the aligorithm or the file extension
+func (r *Request) Format() string {
+	if r.Aligorithm != "" {
+		return strings.ToLower(r.Aligorithm)
+	}
+	if strings.EqualFold(filepath.Ext(r.File), ".tar") {
+		return FormatTar
+	}
+	return FormatZip
+}
+
+// validateCriteria check if age and size criteria are valid
+func (r *Request) validateCriteria() error {
+	for _, age := range []string{r.OlderThan, r.NewerThan} {
+		if age == "" {
+			continue
+		}
+		if _, err := ParseCutoff(age, time.Now()); err != nil {
+			return err
+		}
+	}
+	if r.Epoch < 0 {
+		return errors.New("epoch must not be negative")
+	}
+	if r.MinSize < 0 || r.MaxSize < 0 {
+		return errors.New("size must not be negative")
+	}
+	if r.MaxSize > 0 && r.MinSize > r.MaxSize {
+		return errors.New("minSize must not exceed maxSize")
+	}
+	return nil
+}
+
+// ArchivePath returns the location of the archive file
+func (r *Request) ArchivePath() string {
+	dir := r.Dir
+	if r.Output != "" {
+		dir = r.Output
+	}
+	return filepath.Join(dir, r.File)
+}
+
+// TargetDir returns the directory entries are extracted to
+func (r *Request) TargetDir() string {
+	if r.Destination != "" {
+		return filepath.Clean(r.Destination)
+	}
+	return filepath.Clean(r.Dir)
+}
+
 // PrepareOutput initiliazes the response object
 func (r *Request) PrepareOutput(request Request) {
 	r.ID = request.ID
@@ -0,0 +1,16 @@
+package models
+
+import "regexp"
+
+// safeName matches names that can be used as a single path element
+var safeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidSecretID check if the id names a secret without leaving the secrets directory
+func ValidSecretID(id string) bool {
+	return safeName.MatchString(id)
+}
+
+// ValidTenant check if the tenant can name its own root directory
+func ValidTenant(tenant string) bool {
+	return safeName.MatchString(tenant)
+}
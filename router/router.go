@@ -1,35 +1,111 @@
 package router
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/greatfocus/archive-service/database"
 	"github.com/greatfocus/archive-service/handler"
+	"github.com/greatfocus/archive-service/metrics"
+	"github.com/greatfocus/archive-service/models"
 	"github.com/greatfocus/archive-service/services"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // LoadRouter creates service handlers in MUx
-func LoadRouter(db *database.Conn) *http.ServeMux {
+func LoadRouter(db *database.Conn, scheduler services.Scheduler) *http.ServeMux {
 	mux := http.NewServeMux()
-	createHanlders(db, mux)
-	log.Println("Created routes with handler")
+	createHanlders(db, scheduler, mux)
+	slog.Info("created routes with handler")
 	return mux
 }
 
 // createHanlders prepares handlers with services requires
-func createHanlders(db *database.Conn, mux *http.ServeMux) {
+func createHanlders(db *database.Conn, scheduler services.Scheduler, mux *http.ServeMux) {
+	// every route is traced, gets a request id and reports its latency by status code
+	handle := func(route string, h http.Handler) {
+		mux.Handle(route, handler.Trace(route, handler.RequestID(handler.Instrument(route, h))))
+	}
+
+	apiKeyService := services.APIKeyService{}
+	apiKeyService.Init(db)
+	jwtService := services.JWTService{}
+	jwtService.Init()
+	auth := handler.Auth{}
+	auth.Init(&apiKeyService, &jwtService)
+	limiter := handler.Limiter{}
+	limiter.Init()
+	apiKeysHandler := handler.APIKeys{}
+	apiKeysHandler.Init(&apiKeyService)
+	// routes are limited per IP before authentication and per caller after it
+	handle("/admin/keys", limiter.LimitIP(auth.Require(limiter.Limit(apiKeysHandler), handler.Scopes{
+		http.MethodGet:    models.ScopeAdmin,
+		http.MethodPost:   models.ScopeAdmin,
+		http.MethodDelete: models.ScopeAdmin,
+	})))
+
+	handle("/admin/log-level", limiter.LimitIP(auth.Require(limiter.Limit(handler.LogLevel{}), handler.Scopes{
+		http.MethodGet: models.ScopeAdmin,
+		http.MethodPut: models.ScopeAdmin,
+	})))
 
 	archiveService := services.ArchiveService{}
 	archiveService.Init(db)
 
 	archiveHandler := handler.Archive{}
 	archiveHandler.Init(&archiveService)
-	mux.Handle("/archive", archiveHandler)
+	handle("/archive", limiter.LimitIP(auth.Require(limiter.Limit(archiveHandler), handler.Scopes{
+		http.MethodGet:  models.ScopeJobsRead,
+		http.MethodPost: models.ScopeArchiveWrite,
+	})))
 
 	extractService := services.ExtractService{}
 	extractService.Init(db)
 	extractHandler := handler.Extract{}
 	extractHandler.Init(&extractService)
-	mux.Handle("/extract", extractHandler)
+	handle("/extract", limiter.LimitIP(auth.Require(limiter.Limit(extractHandler), handler.Scopes{
+		http.MethodGet:  models.ScopeJobsRead,
+		http.MethodPost: models.ScopeExtractWrite,
+	})))
+
+	verifyService := services.VerifyService{}
+	verifyService.Init(db)
+	verifyHandler := handler.Verify{}
+	verifyHandler.Init(&verifyService)
+	handle("/verify", limiter.LimitIP(auth.Require(limiter.Limit(verifyHandler), handler.Scopes{
+		http.MethodGet:  models.ScopeJobsRead,
+		http.MethodPost: models.ScopeArchiveWrite,
+	})))
+
+	keyService := services.KeyService{}
+	keyService.Init()
+	keysHandler := handler.Keys{}
+	keysHandler.Init(&keyService)
+	handle("/keys", limiter.LimitIP(limiter.Limit(keysHandler)))
+
+	queueService := services.QueueService{}
+	queueService.Init(db)
+	metrics.RegisterQueue(func() ([]models.JobCount, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return queueService.Count(ctx)
+	})
+	handle("/metrics", limiter.LimitIP(auth.Require(promhttp.Handler(), handler.Scopes{
+		http.MethodGet: models.ScopeMetricsRead,
+	})))
+
+	// probes stay public, unlimited and out of the access log
+	healthService := services.HealthService{}
+	healthService.Init(db, scheduler, &queueService)
+	mux.Handle("/healthz", handler.Live{})
+	readyHandler := handler.Ready{}
+	readyHandler.Init(&healthService)
+	mux.Handle("/readyz", readyHandler)
+	statusHandler := handler.Status{}
+	statusHandler.Init(&healthService)
+	handle("/status", limiter.LimitIP(auth.Require(limiter.Limit(statusHandler), handler.Scopes{
+		http.MethodGet: models.ScopeMetricsRead,
+	})))
 }
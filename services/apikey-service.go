@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// apiKeyPrefix marks tokens issued by the service
+const apiKeyPrefix = "ask_"
+
+// ErrInvalidKey is returned for unknown or revoked API keys
+var ErrInvalidKey = errors.New("invalid api key")
+
+// APIKeyService struct
+type APIKeyService struct {
+	database *database.Conn
+}
+
+// Init method
+func (k *APIKeyService) Init(db *database.Conn) {
+	k.database = db
+}
+
+// CreateKey issues a new key, only its sha256 is stored
+func (k *APIKeyService) CreateKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return key, err
+	}
+	now := time.Now().UTC()
+	key.ID = uuid.New().String()
+	key.CreatedOn = &now
+	key.Token = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	query := `
+	insert into api_keys (id, name, tenant, hash, scopes, certNames)
+	VALUES(?,?,?,?,?,?);
+	`
+	_, inserted := k.database.Insert(ctx, query, key.ID, key.Name, key.Tenant, hashToken(key.Token), key.Scopes, key.CertNames)
+	if !inserted {
+		return key, errors.New("failed to insert api key")
+	}
+	return key, nil
+}
+
+// GetKeys lists the keys of the tenant without their tokens, every key when the tenant is empty
+func (k *APIKeyService) GetKeys(ctx context.Context, tenant string) ([]models.APIKey, error) {
+	query := `
+	select id, name, tenant, scopes, certNames, revoked, createdOn
+	from api_keys
+	where ? = '' or tenant = ?
+	order by createdOn
+	`
+	rows, err := k.database.Query(ctx, query, tenant, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Tenant, &key.Scopes, &key.CertNames, &key.Revoked, &key.CreatedOn); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey stops the key of the tenant from authenticating, any key when the tenant is empty
+func (k *APIKeyService) RevokeKey(ctx context.Context, id string, tenant string) error {
+	query := `
+    UPDATE api_keys SET revoked=1 WHERE id=? and (? = '' or tenant = ?);
+  	`
+	if !k.database.Update(ctx, query, id, tenant, tenant) {
+		return errors.New("failed to revoke api key")
+	}
+	return nil
+}
+
+// Authenticate finds the active key of the token, ADMIN_API_KEY is accepted as a bootstrap admin key
+func (k *APIKeyService) Authenticate(ctx context.Context, token string) (*models.APIKey, error) {
+	if token == "" {
+		return nil, ErrInvalidKey
+	}
+	hash := hashToken(token)
+	if admin := os.Getenv("ADMIN_API_KEY"); admin != "" {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(admin))) == 1 {
+			return &models.APIKey{ID: "admin", Name: "admin", Scopes: models.StringList{models.ScopeAdmin}}, nil
+		}
+	}
+
+	query := `
+	select id, name, tenant, scopes, certNames
+	from api_keys
+	where hash = ? and revoked = 0
+	`
+	row := k.database.Select(ctx, query, hash)
+	key := &models.APIKey{}
+	err := row.Scan(&key.ID, &key.Name, &key.Tenant, &key.Scopes, &key.CertNames)
+	switch err {
+	case nil:
+		return key, nil
+	case sql.ErrNoRows:
+		return nil, ErrInvalidKey
+	default:
+		return nil, err
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,21 +1,27 @@
 package services
 
 import (
-	"archive/zip"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/metrics"
 	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ArchiveService struct
@@ -28,24 +34,91 @@ func (a *ArchiveService) Init(db *database.Conn) {
 	a.database = db
 }
 
+// CreateArchive runs the archive, or queues it when requested in the background
 func (a *ArchiveService) CreateArchive(ctx context.Context, req *models.Request) (*models.Request, error) {
-	_, err := a.insertRecordToDB(ctx, req)
-	if err != nil {
+	ctx, span := tracing.Start(ctx, "ArchiveService.CreateArchive", jobAttributes(req)...)
+	res, err := a.createArchive(ctx, req)
+	span.SetAttributes(attribute.String("job.id", req.ID))
+	tracing.End(span, err)
+	return res, err
+}
+
+func (a *ArchiveService) createArchive(ctx context.Context, req *models.Request) (*models.Request, error) {
+	// dry run only lists the matched files
+	if req.DryRun {
+		files, err := getListOfFileNames(req)
+		if err != nil {
+			return req, err
+		}
+		req.Files = files
+		req.EstimatedSize = estimateZipSize(files)
+		return req, nil
+	}
+
+	// retries with the same idempotency key get the original job
+	if req.IdempotencyKey != "" {
+		jobID, err := claimIdempotencyKey(ctx, a.database, "archive", req)
+		if err != nil {
+			return req, err
+		}
+		if jobID != "" {
+			job, err := a.GetStatus(ctx, jobID, req.Tenant)
+			return &job, err
+		}
+		defer releaseIdempotencyKey(ctx, a.database, req)
+	}
+
+	if err := checkStorageQuota(ctx, a.database, req.Tenant); err != nil {
 		return req, err
 	}
 
 	// Check for background execution
 	if req.Background {
-		return req, nil
-	} else {
-		// update the database
-		return a.InitiateArchive(ctx, req)
+		if err := checkQueue(ctx, a.database, req.KeyID); err != nil {
+			return req, err
+		}
+		_, err := a.insertRecordToDB(ctx, req)
+		return req, err
 	}
+
+	// no job is created when the tenant has no free slot
+	release, err := acquireJobSlot(req.Tenant)
+	if err != nil {
+		return req, err
+	}
+	defer release()
+	_, err = a.insertRecordToDB(ctx, req)
+	if err != nil {
+		return req, err
+	}
+	return a.runArchive(ctx, req)
 }
 
+// InitiateArchive runs a queued archive once the tenant has a free slot
 func (a *ArchiveService) InitiateArchive(ctx context.Context, req *models.Request) (*models.Request, error) {
+	ctx, span := tracing.Start(ctx, "ArchiveService.InitiateArchive", jobAttributes(req)...)
+	res, err := a.initiateArchive(ctx, req)
+	tracing.End(span, err)
+	return res, err
+}
+
+func (a *ArchiveService) initiateArchive(ctx context.Context, req *models.Request) (*models.Request, error) {
+	release, err := acquireJobSlot(req.Tenant)
+	if err != nil {
+		return req, err
+	}
+	defer release()
+	return a.runArchive(ctx, req)
+}
+
+func (a *ArchiveService) runArchive(ctx context.Context, req *models.Request) (*models.Request, error) {
+	ctx = logging.WithJobID(ctx, req.ID)
+	slog.InfoContext(ctx, "archive started", "file", req.File)
+	start := time.Now()
 	_, err := a.archiveFiles(ctx, req)
+	metrics.JobFinished("archive", req.Format(), start, err)
 	if err != nil {
+		slog.ErrorContext(ctx, "archive failed", "err", err)
 		return req, err
 	}
 
@@ -54,16 +127,57 @@ func (a *ArchiveService) InitiateArchive(ctx context.Context, req *models.Reques
 	if err != nil {
 		return req, err
 	}
+	slog.InfoContext(ctx, "archive finished", "size", req.Size, "duration_ms", time.Since(start).Milliseconds())
 	return req, nil
 }
 
 func (a *ArchiveService) archiveFiles(ctx context.Context, req *models.Request) (*models.Request, error) {
-	fileNames, err := getListOfFileNames(req)
+	files, err := getListOfFileNames(req)
 	if err != nil {
 		return req, err
 	}
+	req.Files = files
 
-	err = compress(fileNames, req)
+	err = compress(files, req)
+	if err != nil {
+		return req, err
+	}
+	if err := a.updateSize(ctx, req); err != nil {
+		return req, err
+	}
+	var read int64
+	for _, file := range files {
+		read += file.Size
+	}
+	metrics.Transferred("archive", read, req.Size)
+	if req.Encrypt {
+		if err := a.updateRecipients(ctx, req); err != nil {
+			return req, err
+		}
+	}
+
+	if req.Manifest == models.ManifestSidecar {
+		if err := writeSidecar(req, files); err != nil {
+			return req, err
+		}
+	}
+	if req.Manifest != "" {
+		if err := a.recordEntries(ctx, req); err != nil {
+			return req, err
+		}
+	}
+	if err := a.sign(ctx, req); err != nil {
+		return req, err
+	}
+
+	if req.SourceAction == "" || req.SourceAction == models.SourceKeep {
+		return req, nil
+	}
+	err = verifyArchive(req, files)
+	if err != nil {
+		return req, err
+	}
+	err = a.applySourceAction(ctx, req)
 	if err != nil {
 		return req, err
 	}
@@ -74,15 +188,21 @@ func (a *ArchiveService) archiveFiles(ctx context.Context, req *models.Request)
 func (a *ArchiveService) insertRecordToDB(ctx context.Context, req *models.Request) (*models.Request, error) {
 	req.ID = uuid.New().String()
 	req.Status = "new"
+	// background jobs continue the trace of the request that created them
+	req.TraceParent = tracing.TraceParent(ctx)
 	query := `
-	INSERT INTO archive(id, fileName, dir, status, aligorithm, filteredNames, background)
-	VALUES($1,$2,$3,$4,$5,$6,$7);
+	INSERT INTO archive(id, fileName, dir, output, status, aligorithm, filteredNames, include, exclude, olderThan, newerThan, minSize, maxSize, sourceAction,
+		reproducible, epoch, manifest, passwordSecret, encrypt, background, keyId, tenant, traceParent)
+	VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23);
 	`
-	_, inserted := a.database.Insert(ctx, query, req.ID, req.File, req.Dir, req.Status, req.Aligorithm, req.FilteredNames, req.Background)
+	_, inserted := a.database.Insert(ctx, query, req.ID, req.File, req.Dir, req.Output, req.Status, req.Aligorithm, req.FilteredNames, req.Include, req.Exclude,
+		req.OlderThan, req.NewerThan, req.MinSize, req.MaxSize, req.SourceAction, req.Reproducible, req.Epoch, req.Manifest, req.PasswordSecret, req.Encrypt, req.Background, req.KeyID, req.Tenant, req.TraceParent)
 	if !inserted {
 		return req, errors.New("failed to insert archive")
 	}
-	return req, nil
+	metrics.JobCreated("archive", req.Format())
+	slog.InfoContext(logging.WithJobID(ctx, req.ID), "archive created", "background", req.Background)
+	return req, bindIdempotencyKey(ctx, a.database, req)
 }
 
 func (a *ArchiveService) updateStatus(ctx context.Context, req *models.Request) error {
@@ -96,105 +216,161 @@ func (a *ArchiveService) updateStatus(ctx context.Context, req *models.Request)
 	return nil
 }
 
-func (a *ArchiveService) GetStatus(ctx context.Context, id string) (models.Request, error) {
+// GetStatus returns the archive when it belongs to the tenant, any archive for callers without a tenant
+func (a *ArchiveService) GetStatus(ctx context.Context, id string, tenant string) (models.Request, error) {
 	query := `
-	select id, fileName, dir, status, createdOn
+	select id, fileName, dir, output, status, recipients, signedBy, keyId, createdOn
 	from archive
-	where id = ?
+	where id = ? and (? = '' or tenant = ?)
 	`
-	row := a.database.Select(ctx, query, id)
+	row := a.database.Select(ctx, query, id, tenant, tenant)
 	result := models.Request{}
-	err := row.Scan(&result.ID, &result.File, &result.Dir, &result.Status, &result.CreatedOn)
+	err := row.Scan(&result.ID, &result.File, &result.Dir, &result.Output, &result.Status, &result.Recipients, &result.SignedBy, &result.KeyID, &result.CreatedOn)
 	switch err {
 	case sql.ErrNoRows:
 		return result, nil
 	case nil:
-		// update cache
-		return result, nil
+		result.Files, err = a.getSources(ctx, id)
+		return result, err
 	default:
 		return result, err
 	}
 }
 
-func compress(files []string, req *models.Request) error {
-	zipPath := req.Dir + req.File
-	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
-	_ = os.Remove(zipPath) // remove a single file
-	file, err := os.OpenFile(zipPath, flags, 0644)
+// updateSize records the archive size counted against the tenant storage quota
+func (a *ArchiveService) updateSize(ctx context.Context, req *models.Request) error {
+	info, err := os.Stat(req.ArchivePath())
 	if err != nil {
-		return errors.New("failed to open zip for writing")
+		return err
 	}
-	defer file.Close()
+	req.Size = info.Size()
+	query := `
+    UPDATE archive SET size=? WHERE id=?;
+  	`
+	if !a.database.Update(ctx, query, req.Size, req.ID) {
+		return errors.New("failed to update archive size")
+	}
+	return nil
+}
 
-	zipw := zip.NewWriter(file)
-	defer zipw.Close()
+// updateRecipients records who the archive was encrypted to
+func (a *ArchiveService) updateRecipients(ctx context.Context, req *models.Request) error {
+	query := `
+    UPDATE archive SET recipients=? WHERE id=?;
+  	`
+	if !a.database.Update(ctx, query, req.Recipients, req.ID) {
+		return errors.New("failed to update archive recipients")
+	}
+	return nil
+}
 
-	for _, filename := range files {
-		if len(filename) > 1 {
-			if err := appendFiles(req.Dir, filename, zipw); err != nil {
-				return err
-			}
-		}
+// sign writes the detached signature when a signing key is configured
+func (a *ArchiveService) sign(ctx context.Context, req *models.Request) error {
+	key, err := loadSigningKey()
+	if err != nil || key == nil {
+		return err
+	}
+	if err := signArchive(key, req.ArchivePath()); err != nil {
+		return err
+	}
+	req.SignedBy = key.id
+	query := `
+    UPDATE archive SET signedBy=? WHERE id=?;
+  	`
+	if !a.database.Update(ctx, query, req.SignedBy, req.ID) {
+		return errors.New("failed to update archive signature")
 	}
 	return nil
 }
 
-func appendFiles(dir, filename string, zipw *zip.Writer) error {
-	fileLoc := dir + "/" + filename
-	file, err := os.Open(fileLoc)
+func compress(files []models.File, req *models.Request) error {
+	zipPath := req.ArchivePath()
+	if err := os.MkdirAll(filepath.Dir(zipPath), dirMode()); err != nil {
+		return fmt.Errorf("failed to create output directory: %s", err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	_ = os.Remove(zipPath) // remove a single file
+	file, err := os.OpenFile(zipPath, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open %s: %s", filename, err)
+		return errors.New("failed to open archive for writing")
 	}
 	defer file.Close()
 
-	wr, err := zipw.Create(filename)
-	if err != nil {
-		msg := "failed to create entry for %s in zip file: %s"
-		return fmt.Errorf(msg, filename, err)
+	var out io.Writer = file
+	var enc io.WriteCloser
+	if req.Encrypt {
+		if enc, err = encryptArchive(req, file); err != nil {
+			return err
+		}
+		out = enc
 	}
 
-	if _, err := io.Copy(wr, file); err != nil {
-		return fmt.Errorf("failed to write %s to zip: %s", filename, err)
+	norm, err := newNormalization(req, files)
+	if err != nil {
+		return err
+	}
+	archw, err := newArchiveWriter(req, out, norm)
+	if err != nil {
+		return err
+	}
+	for i := range files {
+		if err := archw.add(req.Dir, &files[i]); err != nil {
+			_ = archw.Close()
+			return err
+		}
+	}
+	if req.Manifest == models.ManifestEntry {
+		if err := addManifest(archw, files); err != nil {
+			_ = archw.Close()
+			return err
+		}
 	}
 
+	// flush the archive trailer and make sure it reached the disk
+	if err := archw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %s", err)
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt archive: %s", err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive: %s", err)
+	}
 	return nil
 }
 
-func getListOfFileNames(req *models.Request) ([]string, error) {
+func getListOfFileNames(req *models.Request) ([]models.File, error) {
 	// filter names
-	var fileNames = make(map[string]string)
-	if len(req.FilteredNames) > 1 {
-		names := strings.Split(req.FilteredNames, "|")
-		for _, n := range names {
-			fileNames[n] = n
-		}
+	filter, err := newFileFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	if filter.hasPatterns() || filter.hasCriteria() {
+		return walkFileNames(req, filter)
 	}
 
 	limit := 10
-	result := make([]string, 10)
-	count := 1
+	result := make([]models.File, 0, limit)
 	files, err := ioutil.ReadDir(req.Dir)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(fileNames) > 0 {
+	if filter.hasNames() {
 		for _, file := range files {
 			if len(file.Name()) > 0 {
-				name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
-				namedFile := fileNames[name]
-				if !file.IsDir() && count <= limit && len(namedFile) > 0 {
-					result[count-1] = file.Name()
-					count++
+				if !file.IsDir() && len(result) < limit && filter.match(file.Name()) && followable(req, file) {
+					result = append(result, models.File{Name: file.Name(), Size: file.Size()})
 				}
 			}
 		}
 	} else {
 		sortFileSizeDescend(files)
 		for _, file := range files {
-			if !file.IsDir() && count <= limit && !strings.Contains(req.File, file.Name()) {
-				result[count-1] = file.Name()
-				count++
+			if !file.IsDir() && len(result) < limit && !strings.Contains(req.File, file.Name()) && followable(req, file) {
+				result = append(result, models.File{Name: file.Name(), Size: file.Size()})
 			}
 		}
 	}
@@ -202,6 +378,62 @@ func getListOfFileNames(req *models.Request) ([]string, error) {
 	return result, nil
 }
 
+// followable check if a listed file may be read, skipping links that leave the allowed roots
+func followable(req *models.Request, file os.FileInfo) bool {
+	return file.Mode()&os.ModeSymlink == 0 || linkAllowed(filepath.Join(req.Dir, file.Name()), req.Tenant)
+}
+
+// walkFileNames lists files in the directory tree that pass the filter
+func walkFileNames(req *models.Request, filter *fileFilter) ([]models.File, error) {
+	zipPath := req.ArchivePath()
+	result := []models.File{}
+	err := filepath.WalkDir(req.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !(d.Type().IsRegular() || d.Type()&fs.ModeSymlink != 0) || filepath.Clean(path) == zipPath {
+			return nil
+		}
+		rel, err := filepath.Rel(req.Dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !filter.match(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// zip follows symlinks, so only links to regular files under the allowed roots are kept
+		if d.Type()&fs.ModeSymlink != 0 && req.Format() != models.FormatTar {
+			if info, err = os.Stat(path); err != nil || !info.Mode().IsRegular() || !linkAllowed(path, req.Tenant) {
+				return nil
+			}
+		}
+		if filter.matchInfo(info) {
+			result = append(result, models.File{Name: name, Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// estimateZipSize is an upper bound of the zip size when entries are stored uncompressed
+func estimateZipSize(files []models.File) int64 {
+	// end of central directory record
+	size := int64(22)
+	for _, file := range files {
+		// local header, data descriptor and central directory header
+		size += 30 + 16 + 46 + 2*int64(len(file.Name)) + file.Size
+	}
+	return size
+}
+
 func sortFileSizeDescend(files []os.FileInfo) {
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].Size() > files[j].Size()
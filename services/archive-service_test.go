@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetStatusByTenant(t *testing.T) {
+	db := testDB(t)
+	archived := testArchive(t, db, "team-b", "report.txt")
+	archiveService := ArchiveService{}
+	archiveService.Init(db)
+
+	for _, c := range []struct {
+		tenant  string
+		visible bool
+	}{
+		{"team-b", true},
+		{"", true}, // global admins see the jobs of every tenant
+		{"team-a", false},
+	} {
+		job, err := archiveService.GetStatus(context.Background(), archived.ID, c.tenant)
+		if err != nil {
+			t.Fatalf("tenant %q: %s", c.tenant, err)
+		}
+		if visible := job.ID == archived.ID; visible != c.visible {
+			t.Errorf("tenant %q: visible = %t, want %t", c.tenant, visible, c.visible)
+		}
+	}
+}
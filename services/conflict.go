@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// plannedEntry pairs an archive entry with where and how it will be written
+type plannedEntry struct {
+	entry  *archiveEntry
+	result models.File
+}
+
+// planEntries resolves the target path and conflict outcome of every entry
+func planEntries(entries []*archiveEntry, req *models.Request) ([]plannedEntry, error) {
+	policy := req.OnConflict
+	if policy == "" {
+		policy = models.ConflictOverwrite
+	}
+
+	reserved := make(map[string]bool)
+	plan := make([]plannedEntry, 0, len(entries))
+	for _, entry := range entries {
+		name := stripComponents(entry.name, req.StripComponents)
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(req.TargetDir(), filepath.FromSlash(name))
+		if !isWithin(req.TargetDir(), path) {
+			return nil, fmt.Errorf("entry %s escapes the destination", entry.name)
+		}
+		result := models.File{
+			Name:   entry.name,
+			Size:   entry.size,
+			Path:   path,
+			Action: models.OutcomeCreated,
+		}
+		if entry.isDir() {
+			plan = append(plan, plannedEntry{entry: entry, result: result})
+			continue
+		}
+
+		info, err := os.Lstat(path)
+		exists := err == nil && !info.IsDir()
+		if exists || reserved[path] {
+			switch policy {
+			case models.ConflictOverwrite:
+				result.Action = models.OutcomeOverwritten
+				result.Overwrite = true
+			case models.ConflictSkip:
+				result.Action = models.OutcomeSkipped
+			case models.ConflictRename:
+				result.Path = nextFreePath(path, reserved)
+				result.Action = models.OutcomeRenamed
+			case models.ConflictNewer:
+				if exists && entry.modified.After(info.ModTime()) {
+					result.Action = models.OutcomeOverwritten
+					result.Overwrite = true
+				} else {
+					result.Action = models.OutcomeSkipped
+				}
+			case models.ConflictFail:
+				return nil, fmt.Errorf("extract conflict: %s already exists", path)
+			}
+		}
+		if result.Action != models.OutcomeSkipped {
+			reserved[result.Path] = true
+		}
+		plan = append(plan, plannedEntry{entry: entry, result: result})
+	}
+	return plan, nil
+}
+
+// nextFreePath appends a counter to the file name until it is unused
+func nextFreePath(path string, reserved map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) && !reserved[candidate] {
+			return candidate
+		}
+	}
+}
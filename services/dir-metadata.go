@@ -0,0 +1,25 @@
+//go:build !windows
+
+package services
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// openDir opens the directory without following a symlink in its place
+func openDir(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_DIRECTORY, 0)
+	if errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.ENOTDIR) {
+		return nil, errNotDir
+	}
+	return f, err
+}
+
+// setModTime sets the access and modification times of the open file
+func setModTime(f *os.File, t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	return syscall.Futimes(int(f.Fd()), []syscall.Timeval{tv, tv})
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"os"
+	"time"
+)
+
+// openDir opens the directory, refusing a symlink in its place
+func openDir(path string) (*os.File, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errNotDir
+	}
+	return os.Open(path)
+}
+
+// setModTime sets the access and modification times of the open file
+func setModTime(f *os.File, t time.Time) error {
+	return os.Chtimes(f.Name(), t, t)
+}
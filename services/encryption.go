@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// ageHeader starts every binary age file
+const ageHeader = "age-encryption.org/v1\n"
+
+// loadRecipients reads the age X25519 public keys from ENCRYPTION_RECIPIENTS_FILE, one per line
+func loadRecipients() ([]age.Recipient, models.StringList, error) {
+	path := os.Getenv("ENCRYPTION_RECIPIENTS_FILE")
+	if path == "" {
+		return nil, nil, errors.New("no encryption recipients configured")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read encryption recipients: %s", err)
+	}
+	var recipients []age.Recipient
+	var names models.StringList
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		recipient, err := age.ParseX25519Recipient(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid encryption recipient: %s", err)
+		}
+		recipients = append(recipients, recipient)
+		names = append(names, recipient.String())
+	}
+	if len(recipients) == 0 {
+		return nil, nil, errors.New("no encryption recipients configured")
+	}
+	return recipients, names, nil
+}
+
+// loadIdentities reads the age identities archives are decrypted with from ENCRYPTION_IDENTITY_FILE
+func loadIdentities() ([]age.Identity, error) {
+	path := os.Getenv("ENCRYPTION_IDENTITY_FILE")
+	if path == "" {
+		return nil, errors.New("no encryption identity configured to decrypt the archive")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption identity: %s", err)
+	}
+	defer file.Close()
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption identity: %s", err)
+	}
+	return identities, nil
+}
+
+// encryptArchive wraps w so the archive is written as an age file, recording the recipients on the request
+func encryptArchive(req *models.Request, w io.Writer) (io.WriteCloser, error) {
+	recipients, names, err := loadRecipients()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt archive: %s", err)
+	}
+	req.Recipients = names
+	return enc, nil
+}
+
+// isAgeEncrypted check if the file starts with the age header
+func isAgeEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	header := make([]byte, len(ageHeader))
+	if _, err := io.ReadFull(file, header); err != nil {
+		// too short to be encrypted, the format reader reports what is wrong
+		return false, nil
+	}
+	return string(header) == ageHeader, nil
+}
+
+// decryptStream returns the plaintext of an age file as it is read
+func decryptStream(path string) (io.ReadCloser, error) {
+	identities, err := loadIdentities()
+	if err != nil {
+		return nil, err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := age.Decrypt(src, identities...)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to decrypt archive: %s", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{plain, src}, nil
+}
+
+// decryptToStage writes the plaintext of an age file next to it, readable only by the service.
+// The staged file is unlinked as soon as it is created, so it goes away with the returned file
+// even when the process dies, where open files cannot be removed the reader removes it on close.
+func decryptToStage(path string) (*os.File, error) {
+	plain, err := decryptStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+
+	staged, err := os.CreateTemp(filepath.Dir(path), ".archive-decrypted-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(staged.Name())
+	fail := func(err error) (*os.File, error) {
+		staged.Close()
+		os.Remove(staged.Name())
+		return nil, err
+	}
+	if _, err := io.Copy(staged, plain); err != nil {
+		return fail(fmt.Errorf("failed to decrypt archive: %s", err))
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return staged, nil
+}
@@ -1,21 +1,24 @@
 package services
 
 import (
-	"archive/zip"
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io"
-	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/metrics"
 	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ExtractService struct
@@ -27,24 +30,86 @@ type ExtractService struct {
 func (e *ExtractService) Init(db *database.Conn) {
 	e.database = db
 }
+
+// CreateExtract runs the extract, or queues it when requested in the background
 func (e *ExtractService) CreateExtract(ctx context.Context, req *models.Request) (*models.Request, error) {
-	_, err := e.insertRecordToDB(ctx, req)
-	if err != nil {
+	ctx, span := tracing.Start(ctx, "ExtractService.CreateExtract", jobAttributes(req)...)
+	res, err := e.createExtract(ctx, req)
+	span.SetAttributes(attribute.String("job.id", req.ID))
+	tracing.End(span, err)
+	return res, err
+}
+
+func (e *ExtractService) createExtract(ctx context.Context, req *models.Request) (*models.Request, error) {
+	// dry run only lists the entries that would be written
+	if req.DryRun {
+		return e.planExtract(req)
+	}
+
+	// retries with the same idempotency key get the original job
+	if req.IdempotencyKey != "" {
+		jobID, err := claimIdempotencyKey(ctx, e.database, "extract", req)
+		if err != nil {
+			return req, err
+		}
+		if jobID != "" {
+			job, err := e.GetStatus(ctx, jobID, req.Tenant)
+			return &job, err
+		}
+		defer releaseIdempotencyKey(ctx, e.database, req)
+	}
+
+	if err := checkStorageQuota(ctx, e.database, req.Tenant); err != nil {
 		return req, err
 	}
 
 	// Check for background execution
 	if req.Background {
-		return req, nil
-	} else {
-		// update the database
-		return e.InitiateExtract(ctx, req)
+		if err := checkQueue(ctx, e.database, req.KeyID); err != nil {
+			return req, err
+		}
+		_, err := e.insertRecordToDB(ctx, req)
+		return req, err
 	}
+
+	// no job is created when the tenant has no free slot
+	release, err := acquireJobSlot(req.Tenant)
+	if err != nil {
+		return req, err
+	}
+	defer release()
+	_, err = e.insertRecordToDB(ctx, req)
+	if err != nil {
+		return req, err
+	}
+	return e.runExtract(ctx, req)
 }
 
+// InitiateExtract runs a queued extract once the tenant has a free slot
 func (e *ExtractService) InitiateExtract(ctx context.Context, req *models.Request) (*models.Request, error) {
-	_, err := e.extractFiles(req)
+	ctx, span := tracing.Start(ctx, "ExtractService.InitiateExtract", jobAttributes(req)...)
+	res, err := e.initiateExtract(ctx, req)
+	tracing.End(span, err)
+	return res, err
+}
+
+func (e *ExtractService) initiateExtract(ctx context.Context, req *models.Request) (*models.Request, error) {
+	release, err := acquireJobSlot(req.Tenant)
+	if err != nil {
+		return req, err
+	}
+	defer release()
+	return e.runExtract(ctx, req)
+}
+
+func (e *ExtractService) runExtract(ctx context.Context, req *models.Request) (*models.Request, error) {
+	ctx = logging.WithJobID(ctx, req.ID)
+	slog.InfoContext(ctx, "extract started", "file", req.File)
+	start := time.Now()
+	_, err := e.extractFiles(ctx, req)
+	metrics.JobFinished("extract", req.Format(), start, err)
 	if err != nil {
+		slog.ErrorContext(ctx, "extract failed", "err", err)
 		return req, err
 	}
 
@@ -53,40 +118,139 @@ func (e *ExtractService) InitiateExtract(ctx context.Context, req *models.Reques
 	if err != nil {
 		return req, err
 	}
+	slog.InfoContext(ctx, "extract finished", "size", req.Size, "duration_ms", time.Since(start).Milliseconds())
 	return req, nil
 }
 
-func (e *ExtractService) extractFiles(req *models.Request) (*models.Request, error) {
-	hasFilteredName := false
-	hasPartialExtraction := false
-	zipPath := req.Dir + req.File
-	read, err := zip.OpenReader(zipPath)
+func (e *ExtractService) extractFiles(ctx context.Context, req *models.Request) (*models.Request, error) {
+	if err := checkSignature(req); err != nil {
+		return req, err
+	}
+	read, err := openArchive(req)
+	if err != nil {
+		return req, err
+	}
+	defer read.Close()
+
+	entries, err := selectEntries(read.entries(), req)
+	if err != nil {
+		return req, err
+	}
+	plan, err := planEntries(entries, req)
+	if err != nil {
+		return req, err
+	}
+
+	restore := newRestorer(ctx, req, plan)
+	err = read.walk(func(entry *archiveEntry, content io.Reader) error {
+		return restore.write(entry, content)
+	})
+	if err != nil {
+		return req, err
+	}
+	if err := restore.finish(); err != nil {
+		return req, err
+	}
+
+	mismatches := 0
+	if req.Verify {
+		digests, err := readManifest(read, req)
+		if err != nil {
+			return req, err
+		}
+		if mismatches, err = verifyExtracted(plan, digests); err != nil {
+			return req, err
+		}
+	}
+
+	req.Files = []models.File{}
+	req.Size = 0
+	for _, entry := range plan {
+		if err := e.insertEntry(ctx, req.ID, entry.result); err != nil {
+			return req, err
+		}
+		req.Files = append(req.Files, entry.result)
+		if entry.result.Action != models.OutcomeSkipped && !entry.entry.isDir() {
+			req.Size += entry.result.Size
+		}
+	}
+	if err := e.updateSize(ctx, req); err != nil {
+		return req, err
+	}
+	metrics.Transferred("extract", archiveSize(req), req.Size)
+	if mismatches > 0 {
+		return req, fmt.Errorf("verification failed for %d entries", mismatches)
+	}
+	return req, nil
+}
+
+// planExtract lists the entries that would be written without touching the disk
+func (e *ExtractService) planExtract(req *models.Request) (*models.Request, error) {
+	if err := checkSignature(req); err != nil {
+		return req, err
+	}
+	read, err := openArchive(req)
 	if err != nil {
-		return req, errors.New("failed to open file")
+		return req, err
 	}
 	defer read.Close()
 
+	entries, err := selectEntries(read.entries(), req)
+	if err != nil {
+		return req, err
+	}
+	plan, err := planEntries(entries, req)
+	if err != nil {
+		return req, err
+	}
+
+	req.Files = []models.File{}
+	for _, entry := range plan {
+		req.Files = append(req.Files, entry.result)
+		if entry.result.Action != models.OutcomeSkipped {
+			req.EstimatedSize += entry.result.Size
+		}
+	}
+	return req, nil
+}
+
+// checkSignature refuses archives whose signature does not verify when required
+func checkSignature(req *models.Request) error {
+	if !req.RequireSignature {
+		return nil
+	}
+	key, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.New("no signing key configured to verify the signature")
+	}
+	return verifySignature(key, req.ArchivePath())
+}
+
+// selectEntries filters the archive entries by names, patterns and positions
+func selectEntries(files []*archiveEntry, req *models.Request) ([]*archiveEntry, error) {
+	hasPartialExtraction := false
+
 	// filter names
-	var fileNames = make(map[string]string)
+	filter, err := newFileFilter(req)
+	if err != nil {
+		return nil, err
+	}
 	var partiallyFiltered = strings.Split(req.PartialExtraction, "|")
-	if len(req.FilteredNames) > 1 {
-		hasFilteredName = true
-		names := strings.Split(req.FilteredNames, "|")
-		for _, n := range names {
-			fileNames[n] = n
-		}
-	} else if len(partiallyFiltered) > 1 {
+	if !filter.hasNames() && len(partiallyFiltered) > 1 {
 		hasPartialExtraction = true
 	}
 
-	for i, file := range read.File {
-		if hasFilteredName && len(fileNames) > 0 {
-			name := strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
-			namedFile := fileNames[name]
-			if len(namedFile) < 1 {
-				continue
-			}
-		} else if hasPartialExtraction {
+	// the manifest describes the archive and is never written over the files
+	stored := manifestEntry(files)
+	result := []*archiveEntry{}
+	for i, file := range files {
+		if file == stored || !filter.match(file.name) {
+			continue
+		}
+		if hasPartialExtraction {
 			found := false
 			for _, r := range partiallyFiltered {
 				record, _ := strconv.ParseInt(r, 6, 12)
@@ -99,40 +263,9 @@ func (e *ExtractService) extractFiles(req *models.Request) (*models.Request, err
 				continue
 			}
 		}
-
-		zippedFile, err := file.Open()
-		if err != nil {
-			return req, err
-		}
-		defer zippedFile.Close()
-
-		extractedFilePath := filepath.Join(
-			req.Dir,
-			file.Name,
-		)
-		if file.FileInfo().IsDir() {
-			log.Println("Directory Created:", extractedFilePath)
-			os.MkdirAll(extractedFilePath, file.Mode())
-		} else {
-			log.Println("File extracted:", file.Name)
-
-			outputFile, err := os.OpenFile(
-				extractedFilePath,
-				os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-				file.Mode(),
-			)
-			if err != nil {
-				return req, err
-			}
-			defer outputFile.Close()
-
-			_, err = io.Copy(outputFile, zippedFile)
-			if err != nil {
-				return req, err
-			}
-		}
+		result = append(result, file)
 	}
-	return req, nil
+	return result, nil
 }
 
 func (e *ExtractService) updateStatus(ctx context.Context, req *models.Request) error {
@@ -146,36 +279,89 @@ func (e *ExtractService) updateStatus(ctx context.Context, req *models.Request)
 	return nil
 }
 
+// updateSize records the extracted bytes counted against the tenant storage quota
+func (e *ExtractService) updateSize(ctx context.Context, req *models.Request) error {
+	query := `
+    UPDATE extract SET size=? WHERE id=?;
+  	`
+	if !e.database.Update(ctx, query, req.Size, req.ID) {
+		return errors.New("failed to update extract size")
+	}
+	return nil
+}
+
 func (e *ExtractService) insertRecordToDB(ctx context.Context, req *models.Request) (*models.Request, error) {
 	req.ID = uuid.New().String()
 	req.Status = "new"
+	// background jobs continue the trace of the request that created them
+	req.TraceParent = tracing.TraceParent(ctx)
 	query := `
-	insert into extract (id, fileName, dir, status, aligorithm, filteredNames, partialExtraction, background)
-	VALUES(?,?,?,?,?,?,?,?);
+	insert into extract (id, fileName, dir, destination, status, aligorithm, filteredNames, include, exclude, partialExtraction, onConflict, stripComponents, skipOwnership, verify, requireSignature, passwordSecret, background, keyId, tenant, traceParent)
+	VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);
 	`
-	_, inserted := e.database.Insert(ctx, query, req.ID, req.File, req.Dir, req.Status, req.Aligorithm, req.FilteredNames, req.PartialExtraction, req.Background)
+	_, inserted := e.database.Insert(ctx, query, req.ID, req.File, req.Dir, req.Destination, req.Status, req.Aligorithm, req.FilteredNames, req.Include, req.Exclude, req.PartialExtraction,
+		req.OnConflict, req.StripComponents, req.SkipOwnership, req.Verify, req.RequireSignature, req.PasswordSecret, req.Background, req.KeyID, req.Tenant, req.TraceParent)
 	if !inserted {
 		return req, errors.New("failed to insert extract")
 	}
-	return req, nil
+	metrics.JobCreated("extract", req.Format())
+	slog.InfoContext(logging.WithJobID(ctx, req.ID), "extract created", "background", req.Background)
+	return req, bindIdempotencyKey(ctx, e.database, req)
 }
 
-func (e *ExtractService) GetStatus(ctx context.Context, id string) (models.Request, error) {
+// GetStatus returns the extract when it belongs to the tenant, any extract for callers without a tenant
+func (e *ExtractService) GetStatus(ctx context.Context, id string, tenant string) (models.Request, error) {
 	query := `
-	select id, fileName, dir, status, createdOn
+	select id, fileName, dir, destination, status, keyId, createdOn
 	from extract
-	where id = ?
+	where id = ? and (? = '' or tenant = ?)
 	`
-	row := e.database.Select(ctx, query, id)
+	row := e.database.Select(ctx, query, id, tenant, tenant)
 	result := models.Request{}
-	err := row.Scan(&result.ID, &result.File, &result.Dir, &result.Status, &result.CreatedOn)
+	err := row.Scan(&result.ID, &result.File, &result.Dir, &result.Destination, &result.Status, &result.KeyID, &result.CreatedOn)
 	switch err {
 	case sql.ErrNoRows:
 		return result, nil
 	case nil:
-		// update cache
-		return result, nil
+		result.Files, err = e.getEntries(ctx, id)
+		return result, err
 	default:
 		return result, err
 	}
 }
+
+func (e *ExtractService) insertEntry(ctx context.Context, extractID string, file models.File) error {
+	query := `
+	insert into extract_entries (extractId, fileName, path, size, outcome, verified)
+	VALUES(?,?,?,?,?,?);
+	`
+	_, inserted := e.database.Insert(ctx, query, extractID, file.Name, file.Path, file.Size, file.Action, file.Verified)
+	if !inserted {
+		return errors.New("failed to insert extract entry")
+	}
+	return nil
+}
+
+func (e *ExtractService) getEntries(ctx context.Context, extractID string) ([]models.File, error) {
+	query := `
+	select fileName, path, size, outcome, verified
+	from extract_entries
+	where extractId = ?
+	order by id
+	`
+	rows, err := e.database.Query(ctx, query, extractID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.File{}
+	for rows.Next() {
+		var file models.File
+		if err := rows.Scan(&file.Name, &file.Path, &file.Size, &file.Action, &file.Verified); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
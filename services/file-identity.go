@@ -0,0 +1,23 @@
+//go:build !windows
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity identifies an inode so hard links can be detected
+type fileIdentity struct {
+	dev uint64
+	ino uint64
+}
+
+// identityOf returns the inode of files that have more than one link
+func identityOf(info os.FileInfo) (fileIdentity, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileIdentity{}, false
+	}
+	return fileIdentity{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,11 @@
+package services
+
+import "os"
+
+// fileIdentity identifies an inode so hard links can be detected
+type fileIdentity struct{}
+
+// identityOf reports no identity since hard links are not archived on windows
+func identityOf(info os.FileInfo) (fileIdentity, bool) {
+	return fileIdentity{}, false
+}
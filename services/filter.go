@@ -0,0 +1,124 @@
+package services
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// fileFilter selects files by legacy names and include/exclude patterns
+type fileFilter struct {
+	names   map[string]string
+	include []models.Pattern
+	exclude []models.Pattern
+
+	olderThan time.Time
+	newerThan time.Time
+	minSize   int64
+	maxSize   int64
+}
+
+// newFileFilter prepares the filter from the request
+func newFileFilter(req *models.Request) (*fileFilter, error) {
+	f := &fileFilter{
+		names:   make(map[string]string),
+		minSize: req.MinSize,
+		maxSize: req.MaxSize,
+	}
+	if len(req.FilteredNames) > 1 {
+		names := strings.Split(req.FilteredNames, "|")
+		for _, n := range names {
+			f.names[n] = n
+		}
+	}
+
+	var err error
+	if f.include, err = compilePatterns(req.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compilePatterns(req.Exclude); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if req.OlderThan != "" {
+		if f.olderThan, err = models.ParseCutoff(req.OlderThan, now); err != nil {
+			return nil, err
+		}
+	}
+	if req.NewerThan != "" {
+		if f.newerThan, err = models.ParseCutoff(req.NewerThan, now); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func compilePatterns(list []string) ([]models.Pattern, error) {
+	patterns := make([]models.Pattern, 0, len(list))
+	for _, p := range list {
+		pattern, err := models.CompilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// hasNames check if legacy filtered names are set
+func (f *fileFilter) hasNames() bool {
+	return len(f.names) > 0
+}
+
+// hasPatterns check if include or exclude patterns are set
+func (f *fileFilter) hasPatterns() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0
+}
+
+// match check if the slash separated path passes the filter
+func (f *fileFilter) match(name string) bool {
+	if f.hasNames() {
+		if len(f.names[strings.TrimSuffix(name, filepath.Ext(name))]) < 1 {
+			return false
+		}
+	}
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+// hasCriteria check if age or size criteria are set
+func (f *fileFilter) hasCriteria() bool {
+	return !f.olderThan.IsZero() || !f.newerThan.IsZero() || f.minSize > 0 || f.maxSize > 0
+}
+
+// matchInfo check if the file satisfies the age and size criteria
+func (f *fileFilter) matchInfo(info fs.FileInfo) bool {
+	if !f.olderThan.IsZero() && !info.ModTime().Before(f.olderThan) {
+		return false
+	}
+	if !f.newerThan.IsZero() && !info.ModTime().After(f.newerThan) {
+		return false
+	}
+	if f.minSize > 0 && info.Size() < f.minSize {
+		return false
+	}
+	if f.maxSize > 0 && info.Size() > f.maxSize {
+		return false
+	}
+	return true
+}
+
+func matchAny(patterns []models.Pattern, name string) bool {
+	for _, p := range patterns {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
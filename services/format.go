@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// archiveEntry is a format independent view of an archive member
+type archiveEntry struct {
+	index    int
+	name     string
+	mode     os.FileMode
+	modified time.Time
+	size     int64
+	uid      int
+	gid      int
+	hasOwner bool
+	linkname string
+	hardlink bool
+}
+
+func (e *archiveEntry) isDir() bool {
+	return e.mode.IsDir()
+}
+
+func (e *archiveEntry) isSymlink() bool {
+	return e.mode&os.ModeSymlink != 0
+}
+
+// archiveReader lists the entries of an archive and streams their content
+type archiveReader interface {
+	entries() []*archiveEntry
+	// walk passes every entry in order together with its content
+	walk(fn func(entry *archiveEntry, content io.Reader) error) error
+	Close() error
+}
+
+// archiveWriter adds files from disk to an archive
+type archiveWriter interface {
+	// add stores the file and records its sha256 when digests are enabled
+	add(dir string, file *models.File) error
+	// addData stores generated content such as the manifest
+	addData(name string, data []byte) error
+	Close() error
+}
+
+// archiveSize returns the size on disk of the archive of the request, 0 when missing
+func archiveSize(req *models.Request) int64 {
+	info, err := os.Stat(req.ArchivePath())
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// openArchive opens the archive of the request in its format, decrypting it when encrypted at rest
+func openArchive(req *models.Request) (archiveReader, error) {
+	path := req.ArchivePath()
+	encrypted, err := isAgeEncrypted(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %s", err)
+	}
+	if !encrypted {
+		return openArchiveFile(req, path)
+	}
+	switch req.Format() {
+	case models.FormatTar:
+		// tar is read sequentially, every pass decrypts the archive again and no plaintext reaches the disk
+		return openTarStream(func() (io.ReadCloser, error) {
+			return decryptStream(path)
+		})
+	case models.FormatZip:
+		password, err := archivePassword(req)
+		if err != nil {
+			return nil, err
+		}
+		// zip needs random access to its central directory
+		staged, err := decryptToStage(path)
+		if err != nil {
+			return nil, err
+		}
+		read, err := openZipFile(staged, password)
+		if err != nil {
+			_ = os.Remove(staged.Name())
+			return nil, err
+		}
+		read.staged = true
+		return read, nil
+	default:
+		return nil, errors.New("unsupported archive format")
+	}
+}
+
+func openArchiveFile(req *models.Request, path string) (archiveReader, error) {
+	switch req.Format() {
+	case models.FormatTar:
+		return openTarReader(path)
+	case models.FormatZip:
+		password, err := archivePassword(req)
+		if err != nil {
+			return nil, err
+		}
+		return openZipReader(path, password)
+	default:
+		return nil, errors.New("unsupported archive format")
+	}
+}
+
+// newArchiveWriter creates a writer for the format of the request
+func newArchiveWriter(req *models.Request, w io.Writer, norm *normalization) (archiveWriter, error) {
+	digest := req.Manifest != ""
+	switch req.Format() {
+	case models.FormatTar:
+		return newTarWriter(w, norm, digest), nil
+	case models.FormatZip:
+		password, err := archivePassword(req)
+		if err != nil {
+			return nil, err
+		}
+		return newZipWriter(w, norm, digest, password, filepath.Dir(req.ArchivePath())), nil
+	default:
+		return nil, errors.New("unsupported archive format")
+	}
+}
+
+// copyContent copies the file content, recording its sha256 when requested
+func copyContent(dst io.Writer, src io.Reader, file *models.File, digest bool) error {
+	if !digest {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dst, h), src); err != nil {
+		return err
+	}
+	file.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// dataModTime is the modification time of generated entries
+func dataModTime(norm *normalization) time.Time {
+	if norm != nil {
+		return norm.epoch
+	}
+	return time.Now()
+}
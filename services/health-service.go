@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// schedulerGrace is how long the every minute tasks may go without running before the service is not ready
+const schedulerGrace = 2 * time.Minute
+
+// Scheduler reports when the background tasks ran
+type Scheduler interface {
+	StartedOn() time.Time
+	LastRuns() map[string]time.Time
+}
+
+// HealthService struct
+type HealthService struct {
+	database  *database.Conn
+	scheduler Scheduler
+	queue     *QueueService
+	startedOn time.Time
+}
+
+// Init method
+func (h *HealthService) Init(db *database.Conn, scheduler Scheduler, queue *QueueService) {
+	h.database = db
+	h.scheduler = scheduler
+	h.queue = queue
+	h.startedOn = time.Now()
+}
+
+// Ready runs the readiness checks, failures are logged with their cause
+func (h *HealthService) Ready(ctx context.Context) ([]models.Check, bool) {
+	checks := []struct {
+		name  string
+		check func() error
+	}{
+		{"database", func() error { return h.database.Ping(ctx) }},
+		{"schema", func() error { return h.database.SchemaReady(ctx) }},
+		{"storage", CheckStorage},
+		{"scheduler", h.checkScheduler},
+	}
+	results := make([]models.Check, 0, len(checks))
+	ready := true
+	for _, c := range checks {
+		err := c.check()
+		if err != nil {
+			slog.WarnContext(ctx, "readiness check failed", "check", c.name, "err", err)
+			ready = false
+		}
+		results = append(results, models.Check{Name: c.name, OK: err == nil})
+	}
+	return results, ready
+}
+
+// checkScheduler fails when the archive or extract task stopped running
+func (h *HealthService) checkScheduler() error {
+	if h.scheduler == nil {
+		return errors.New("scheduler is not running")
+	}
+	runs := h.scheduler.LastRuns()
+	for _, name := range []string{"archive", "extract"} {
+		last, ok := runs[name]
+		if !ok {
+			last = h.scheduler.StartedOn()
+		}
+		if since := time.Since(last); since > schedulerGrace {
+			return fmt.Errorf("%s task last ran %s ago", name, since.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// Status reports the build, uptime, jobs by status and the last scheduler runs
+func (h *HealthService) Status(ctx context.Context) (models.Status, error) {
+	status := models.Status{
+		Version:   "unknown",
+		StartedOn: h.startedOn,
+		Uptime:    time.Since(h.startedOn).Round(time.Second).String(),
+		LastRuns:  map[string]time.Time{},
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		status.Version = info.Main.Version
+		status.GoVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				status.Revision = setting.Value
+			}
+		}
+	}
+	if h.scheduler != nil {
+		status.LastRuns = h.scheduler.LastRuns()
+	}
+	jobs, err := h.queue.Count(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.Jobs = jobs
+	return status, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// defaultIdempotencyTTL is how long keys are remembered when IDEMPOTENCY_TTL is not configured
+const defaultIdempotencyTTL = 24 * time.Hour
+
+var (
+	// ErrIdempotencyMismatch is returned when an idempotency key is reused with a different request
+	ErrIdempotencyMismatch = errors.New("idempotency key was used with a different request")
+	// ErrIdempotencyInProgress is returned when the first request with the key has not created its job yet
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+)
+
+// claimIdempotencyKey reserves the key of the caller for this request, returning the job of an earlier identical request
+func claimIdempotencyKey(ctx context.Context, db *database.Conn, kind string, req *models.Request) (string, error) {
+	fingerprint, err := requestFingerprint(kind, req)
+	if err != nil {
+		return "", err
+	}
+	expiry := fmt.Sprintf("-%d seconds", int64(idempotencyTTL().Seconds()))
+	db.Delete(ctx, `DELETE FROM idempotency_keys WHERE createdOn < datetime('now', ?);`, expiry)
+
+	query := `
+	insert into idempotency_keys (keyId, idempotencyKey, fingerprint)
+	VALUES(?,?,?);
+	`
+	if _, inserted := db.Insert(ctx, query, req.KeyID, req.IdempotencyKey, fingerprint); inserted {
+		return "", nil
+	}
+
+	query = `
+	select fingerprint, jobId
+	from idempotency_keys
+	where keyId = ? and idempotencyKey = ?
+	`
+	var stored, jobID string
+	err = db.Select(ctx, query, req.KeyID, req.IdempotencyKey).Scan(&stored, &jobID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", errors.New("failed to insert idempotency key")
+	case err != nil:
+		return "", err
+	case stored != fingerprint:
+		return "", ErrIdempotencyMismatch
+	case jobID == "":
+		return "", ErrIdempotencyInProgress
+	}
+	return jobID, nil
+}
+
+// bindIdempotencyKey points the claimed key at the job created for it
+func bindIdempotencyKey(ctx context.Context, db *database.Conn, req *models.Request) error {
+	if req.IdempotencyKey == "" {
+		return nil
+	}
+	query := `
+    UPDATE idempotency_keys SET jobId=? WHERE keyId=? and idempotencyKey=?;
+  	`
+	if !db.Update(ctx, query, req.ID, req.KeyID, req.IdempotencyKey) {
+		return errors.New("failed to update idempotency key")
+	}
+	return nil
+}
+
+// releaseIdempotencyKey frees a claimed key when no job was created, so the request can be retried
+func releaseIdempotencyKey(ctx context.Context, db *database.Conn, req *models.Request) {
+	query := `
+    DELETE FROM idempotency_keys WHERE keyId=? and idempotencyKey=? and jobId='';
+  	`
+	db.Delete(ctx, query, req.KeyID, req.IdempotencyKey)
+}
+
+// idempotencyTTL returns how long keys are remembered, IDEMPOTENCY_TTL is a duration such as 24h
+func idempotencyTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return ttl
+}
+
+// requestFingerprint hashes the kind of job with the request as sent, before the service fills in any field
+func requestFingerprint(kind string, req *models.Request) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(kind+"\n"), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
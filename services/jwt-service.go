@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// jwksRefresh is how long loaded keys are trusted before the JWKS is read again
+const jwksRefresh = 10 * time.Minute
+
+// jwksMinRefresh limits reloads triggered by tokens with unknown key ids
+const jwksMinRefresh = time.Minute
+
+// jwksRetry is the wait after a failed reload, doubled on each failure in a row up to jwksRefresh
+const jwksRetry = 5 * time.Second
+
+// ErrInvalidToken is returned for bearer tokens that fail validation
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// JWTService validates bearer tokens against a JWKS read from JWKS_FILE or JWKS_URL
+type JWTService struct {
+	source      string
+	issuer      string
+	audience    string
+	tenantClaim string
+	scopeClaim  string
+
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	loadedOn   time.Time
+	refreshing bool
+	failures   int
+	retryOn    time.Time
+}
+
+// Init method
+func (j *JWTService) Init() {
+	j.source = os.Getenv("JWKS_FILE")
+	if j.source == "" {
+		j.source = os.Getenv("JWKS_URL")
+	}
+	j.issuer = os.Getenv("JWT_ISSUER")
+	j.audience = os.Getenv("JWT_AUDIENCE")
+	if j.source != "" && (j.issuer == "" || j.audience == "") {
+		logging.Fatal("JWT_ISSUER and JWT_AUDIENCE are required with JWKS_FILE or JWKS_URL")
+	}
+	j.tenantClaim = envOr("JWT_TENANT_CLAIM", "tenant")
+	j.scopeClaim = envOr("JWT_SCOPE_CLAIM", "scope")
+}
+
+// Authenticate validates the token and maps its claims to the caller
+func (j *JWTService) Authenticate(ctx context.Context, token string) (*models.Caller, error) {
+	if j.source == "" {
+		return nil, errors.New("no JWKS configured")
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+		jwt.WithIssuer(j.issuer),
+		jwt.WithAudience(j.audience),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return j.key(ctx, kid)
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	caller := &models.Caller{ID: subject, Scopes: claimList(claims[j.scopeClaim])}
+	caller.Tenant, _ = claims[j.tenantClaim].(string)
+	return caller, nil
+}
+
+// key returns the verification key, reloading the JWKS when stale or when the key id is unknown.
+// A failed reload keeps the loaded keys in use and is retried with a growing delay.
+func (j *JWTService) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	age := time.Since(j.loadedOn)
+	_, known := j.keys[kid]
+	stale := j.keys == nil || age > jwksRefresh || (!known && age > jwksMinRefresh)
+	if stale && !j.refreshing && time.Now().After(j.retryOn) {
+		if err := j.refresh(ctx); err != nil && j.keys == nil {
+			return nil, err
+		}
+	}
+	if j.keys == nil {
+		return nil, errors.New("JWKS is not loaded yet")
+	}
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	// tokens without a key id are accepted when the set holds a single key
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// refresh reloads the JWKS without holding the lock, so requests keep using the loaded keys meanwhile.
+// It is called and returns with j.mu held.
+func (j *JWTService) refresh(ctx context.Context) error {
+	j.refreshing = true
+	j.mu.Unlock()
+	keys, err := loadJWKS(ctx, j.source)
+	j.mu.Lock()
+	j.refreshing = false
+
+	if err != nil {
+		delay := jwksRetry << j.failures
+		if delay <= 0 || delay > jwksRefresh {
+			delay = jwksRefresh
+		} else {
+			j.failures++
+		}
+		j.retryOn = time.Now().Add(delay)
+		slog.WarnContext(ctx, "JWKS reload failed", "err", err, "cached_keys", len(j.keys), "retry_in", delay.String())
+		return err
+	}
+	j.keys = keys
+	j.loadedOn = time.Now()
+	j.failures = 0
+	j.retryOn = time.Time{}
+	return nil
+}
+
+// jwk is a JSON web key as described in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the key set from a file or an http(s) URL
+func loadJWKS(ctx context.Context, source string) (map[string]crypto.PublicKey, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetchJWKS(ctx, source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %s", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %s", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %s", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func fetchJWKS(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// claimList reads a space separated scope string or an array of strings
+func claimList(value interface{}) models.StringList {
+	var list models.StringList
+	switch v := value.(type) {
+	case string:
+		list = strings.Fields(v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"encoding/base64"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// KeyService struct
+type KeyService struct{}
+
+// Init method
+func (k *KeyService) Init() {}
+
+// GetKeys returns the public half of the configured signing key
+func (k *KeyService) GetKeys() ([]models.Key, error) {
+	key, err := loadSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.Key{}
+	if key != nil {
+		keys = append(keys, models.Key{
+			ID:        key.id,
+			Algorithm: "Ed25519ph",
+			PublicKey: base64.StdEncoding.EncodeToString(key.public),
+		})
+	}
+	return keys, nil
+}
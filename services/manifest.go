@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// manifestName is the archive entry holding the manifest, kept apart from the archived files
+const manifestName = ".archive-service/MANIFEST.json"
+
+// manifestSuffix is appended to the archive path for sidecar manifests
+const manifestSuffix = ".manifest.json"
+
+// errNoManifest is returned when neither a manifest entry nor a sidecar exists
+var errNoManifest = errors.New("archive has no manifest")
+
+// manifest lists the sha256 digest of every archived file
+type manifest struct {
+	Version   int            `json:"version"`
+	Algorithm string         `json:"algorithm"`
+	Files     []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// buildManifest encodes the digests of the files
+func buildManifest(files []models.File) ([]byte, error) {
+	m := manifest{Version: 1, Algorithm: "sha256", Files: []manifestFile{}}
+	for _, file := range files {
+		if file.SHA256 == "" {
+			continue
+		}
+		m.Files = append(m.Files, manifestFile{Name: file.Name, Size: file.Size, SHA256: file.SHA256})
+	}
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// addManifest stores the manifest as the last archive entry
+func addManifest(archw archiveWriter, files []models.File) error {
+	for _, file := range files {
+		if file.Name == manifestName {
+			return fmt.Errorf("%s is reserved for the manifest", manifestName)
+		}
+	}
+	data, err := buildManifest(files)
+	if err != nil {
+		return err
+	}
+	return archw.addData(manifestName, data)
+}
+
+// writeSidecar stores the manifest next to the archive
+func writeSidecar(req *models.Request, files []models.File) error {
+	data, err := buildManifest(files)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(req.ArchivePath()+manifestSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest for writing: %s", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %s", err)
+	}
+	return file.Sync()
+}
+
+// manifestEntry returns the entry holding the manifest, if any
+func manifestEntry(entries []*archiveEntry) *archiveEntry {
+	for _, entry := range entries {
+		if entry.name == manifestName {
+			return entry
+		}
+	}
+	return nil
+}
+
+// readManifest loads the digests from the manifest entry, or else from the sidecar
+func readManifest(read archiveReader, req *models.Request) (map[string]string, error) {
+	var data []byte
+	if stored := manifestEntry(read.entries()); stored != nil {
+		err := read.walk(func(entry *archiveEntry, content io.Reader) error {
+			if entry.index != stored.index {
+				return nil
+			}
+			var err error
+			data, err = io.ReadAll(content)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data == nil {
+		var err error
+		data, err = os.ReadFile(req.ArchivePath() + manifestSuffix)
+		if err != nil {
+			return nil, errNoManifest
+		}
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %s", err)
+	}
+	digests := make(map[string]string, len(m.Files))
+	for _, file := range m.Files {
+		digests[file.Name] = file.SHA256
+	}
+	return digests, nil
+}
+
+// verifyExtracted hashes the written files and compares them with the manifest
+func verifyExtracted(plan []plannedEntry, digests map[string]string) (int, error) {
+	mismatches := 0
+	for i := range plan {
+		entry, result := plan[i].entry, &plan[i].result
+		if entry.isDir() || entry.isSymlink() || result.Action == models.OutcomeSkipped {
+			continue
+		}
+		expected, ok := digests[entry.name]
+		if !ok {
+			result.Verified = models.VerifiedUnlisted
+			continue
+		}
+		actual, err := fileDigest(result.Path)
+		if err != nil {
+			return mismatches, err
+		}
+		result.SHA256 = actual
+		result.Verified = models.VerifiedOK
+		if actual != expected {
+			result.Verified = models.VerifiedMismatch
+			mismatches++
+		}
+	}
+	return mismatches, nil
+}
+
+// fileDigest returns the hex sha256 of the file content
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordEntries stores the digest of every archived file
+func (a *ArchiveService) recordEntries(ctx context.Context, req *models.Request) error {
+	query := `
+	INSERT INTO archive_entries(archiveId, fileName, size, sha256)
+	VALUES(?,?,?,?);
+	`
+	for _, file := range req.Files {
+		if file.SHA256 == "" {
+			continue
+		}
+		_, inserted := a.database.Insert(ctx, query, req.ID, file.Name, file.Size, file.SHA256)
+		if !inserted {
+			return errors.New("failed to insert archive entry")
+		}
+	}
+	return nil
+}
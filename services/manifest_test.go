@@ -0,0 +1,15 @@
+package services
+
+import "testing"
+
+func TestManifestEntry(t *testing.T) {
+	stored := &archiveEntry{index: 1, name: manifestName}
+	if got := manifestEntry([]*archiveEntry{{name: "a.txt"}, stored}); got != stored {
+		t.Errorf("manifest entry = %v, want %s", got, manifestName)
+	}
+	// a file the user archived under the old name is theirs, even as the last entry
+	user := []*archiveEntry{{name: "a.txt"}, {index: 1, name: "MANIFEST.json"}}
+	if got := manifestEntry(user); got != nil {
+		t.Errorf("%s was taken for the manifest", got.name)
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultDirMode is used when DIR_PERMISSIONS is not configured
+const defaultDirMode os.FileMode = 0755
+
+// dirMode returns the permissions for directories created by the service
+func dirMode() os.FileMode {
+	mode, err := strconv.ParseUint(os.Getenv("DIR_PERMISSIONS"), 8, 32)
+	if err != nil {
+		return defaultDirMode
+	}
+	return os.FileMode(mode).Perm()
+}
+
+// stripComponents removes the leading path elements of a slash separated entry name
+func stripComponents(name string, count int) string {
+	if count <= 0 {
+		return name
+	}
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	if len(parts) <= count {
+		return ""
+	}
+	stripped := strings.Join(parts[count:], "/")
+	if strings.HasSuffix(name, "/") {
+		stripped += "/"
+	}
+	return stripped
+}
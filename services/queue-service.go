@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// QueueService struct
+type QueueService struct {
+	database *database.Conn
+}
+
+// Init method
+func (q *QueueService) Init(db *database.Conn) {
+	q.database = db
+}
+
+// Count returns the number of archive, extract and verify jobs in each status
+func (q *QueueService) Count(ctx context.Context) ([]models.JobCount, error) {
+	query := `
+	select 'archive', status, count(*) from archive group by status
+	union all
+	select 'extract', status, count(*) from extract group by status
+	union all
+	select 'verify', status, count(*) from verification group by status
+	`
+	rows, err := q.database.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.JobCount{}
+	for rows.Next() {
+		var count models.JobCount
+		if err := rows.Scan(&count.Type, &count.Status, &count.Jobs); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
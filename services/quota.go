@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/metrics"
+)
+
+var (
+	// ErrTooManyJobs is returned when the tenant already runs its maximum of jobs
+	ErrTooManyJobs = errors.New("tenant is running its maximum of concurrent jobs")
+	// ErrStorageQuota is returned when the tenant used up its storage quota
+	ErrStorageQuota = errors.New("tenant storage quota exceeded")
+	// ErrQueueFull is returned when the client already has its maximum of background jobs waiting
+	ErrQueueFull = errors.New("too many queued jobs")
+)
+
+// tenantConfigDir holds the quotas of each tenant as <tenant>.json under TENANTS_DIR. Tenant names
+// cannot start with a dot, so it is outside the directory of every tenant.
+const tenantConfigDir = ".config"
+
+// tenantQuota overrides TENANT_MAX_JOBS and TENANT_STORAGE_QUOTA for one tenant, 0 for unlimited
+type tenantQuota struct {
+	MaxJobs      *int64 `json:"maxJobs"`
+	StorageQuota *int64 `json:"storageQuota"`
+}
+
+// quotas returns the job slots and storage bytes of the tenant, from its config file when it has one
+// and otherwise from the environment
+func quotas(tenant string) (maxJobs int64, storage int64, err error) {
+	maxJobs, storage = envInt("TENANT_MAX_JOBS"), envInt("TENANT_STORAGE_QUOTA")
+	base := os.Getenv("TENANTS_DIR")
+	if base == "" || tenant == "" {
+		return maxJobs, storage, nil
+	}
+	data, err := os.ReadFile(filepath.Join(base, tenantConfigDir, tenant+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return maxJobs, storage, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var quota tenantQuota
+	if err := json.Unmarshal(data, &quota); err != nil {
+		return 0, 0, fmt.Errorf("invalid quotas of tenant %s: %s", tenant, err)
+	}
+	if quota.MaxJobs != nil {
+		maxJobs = *quota.MaxJobs
+	}
+	if quota.StorageQuota != nil {
+		storage = *quota.StorageQuota
+	}
+	return maxJobs, storage, nil
+}
+
+var (
+	runningMu sync.Mutex
+	running   = map[string]int{}
+)
+
+// acquireJobSlot reserves one of the concurrent jobs of the tenant
+func acquireJobSlot(tenant string) (func(), error) {
+	limit, _, err := quotas(tenant)
+	if err != nil {
+		return nil, err
+	}
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if limit > 0 && running[tenant] >= int(limit) {
+		return nil, ErrTooManyJobs
+	}
+	running[tenant]++
+	metrics.WorkersMax(tenant, limit)
+	metrics.WorkerBusy(tenant, 1)
+	return func() {
+		runningMu.Lock()
+		defer runningMu.Unlock()
+		running[tenant]--
+		metrics.WorkerBusy(tenant, -1)
+	}, nil
+}
+
+// checkStorageQuota refuses new jobs once the archives and extracts of the tenant reach its storage quota in bytes
+func checkStorageQuota(ctx context.Context, db *database.Conn, tenant string) error {
+	_, quota, err := quotas(tenant)
+	if err != nil {
+		return err
+	}
+	if quota <= 0 {
+		return nil
+	}
+	query := `
+	select (select coalesce(sum(size), 0) from archive where tenant = ?) +
+		(select coalesce(sum(size), 0) from extract where tenant = ?)
+	`
+	var used int64
+	if err := db.Select(ctx, query, tenant, tenant).Scan(&used); err != nil {
+		return err
+	}
+	if used >= quota {
+		return ErrStorageQuota
+	}
+	return nil
+}
+
+// checkQueue refuses background jobs once the client has MAX_QUEUED_JOBS archives and extracts waiting to run
+func checkQueue(ctx context.Context, db *database.Conn, keyID string) error {
+	limit := envInt("MAX_QUEUED_JOBS")
+	if limit <= 0 {
+		return nil
+	}
+	query := `
+	select (select count(*) from archive where keyId = ? and status = 'new' and background = 1) +
+		(select count(*) from extract where keyId = ? and status = 'new' and background = 1)
+	`
+	var queued int64
+	if err := db.Select(ctx, query, keyID, keyID).Scan(&queued); err != nil {
+		return err
+	}
+	if queued >= limit {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+func envInt(key string) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// withTenantQuotas sets TENANTS_DIR with the config file of each tenant
+func withTenantQuotas(t *testing.T, configs map[string]string) {
+	t.Helper()
+	base := t.TempDir()
+	dir := filepath.Join(base, tenantConfigDir)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tenant, config := range configs {
+		if err := os.WriteFile(filepath.Join(dir, tenant+".json"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TENANTS_DIR", base)
+}
+
+func TestQuotasPerTenant(t *testing.T) {
+	t.Setenv("TENANT_MAX_JOBS", "3")
+	t.Setenv("TENANT_STORAGE_QUOTA", "1000")
+	withTenantQuotas(t, map[string]string{
+		"team-a": `{"maxJobs": 1, "storageQuota": 0}`,
+		"team-b": `{"storageQuota": 50}`,
+		"team-c": `not json`,
+	})
+	for _, c := range []struct {
+		tenant           string
+		maxJobs, storage int64
+	}{
+		{"team-a", 1, 0},
+		{"team-b", 3, 50},
+		{"team-d", 3, 1000}, // no config file, the environment applies
+	} {
+		maxJobs, storage, err := quotas(c.tenant)
+		if err != nil {
+			t.Fatalf("%s: %s", c.tenant, err)
+		}
+		if maxJobs != c.maxJobs || storage != c.storage {
+			t.Errorf("%s: quotas = %d jobs and %d bytes, want %d and %d", c.tenant, maxJobs, storage, c.maxJobs, c.storage)
+		}
+	}
+	if _, _, err := quotas("team-c"); err == nil {
+		t.Error("an invalid config was accepted")
+	}
+
+	release, err := acquireJobSlot("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if _, err := acquireJobSlot("team-a"); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("second job of team-a: err = %v, want %v", err, ErrTooManyJobs)
+	}
+	other, err := acquireJobSlot("team-d")
+	if err != nil {
+		t.Fatalf("team-d shares the slots of team-a: %s", err)
+	}
+	other()
+}
+
+func TestStorageQuotaPerTenant(t *testing.T) {
+	db := testDB(t)
+	withTenantQuotas(t, map[string]string{"team-a": `{"storageQuota": 1}`})
+	testArchive(t, db, "team-a", "first.txt")
+	testArchive(t, db, "team-b", "first.txt")
+
+	archiveService := ArchiveService{}
+	archiveService.Init(db)
+	for tenant, want := range map[string]error{"team-a": ErrStorageQuota, "team-b": nil} {
+		req := &models.Request{File: "/again.tar", Dir: t.TempDir(), Tenant: tenant}
+		if _, err := archiveService.CreateArchive(context.Background(), req); !errors.Is(err, want) {
+			t.Errorf("%s: err = %v, want %v", tenant, err, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// normalization pins the metadata that differs between runs over identical inputs
+type normalization struct {
+	epoch time.Time
+}
+
+// newNormalization sorts the files and resolves the epoch every entry is stamped with
+func newNormalization(req *models.Request, files []models.File) (*normalization, error) {
+	if !req.Reproducible {
+		return nil, nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	if req.Epoch > 0 {
+		return &normalization{epoch: time.Unix(req.Epoch, 0).UTC()}, nil
+	}
+
+	// derive the epoch from the newest source file
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Lstat(filepath.Join(req.Dir, filepath.FromSlash(file.Name)))
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return &normalization{epoch: latest.Truncate(time.Second).UTC()}, nil
+}
+
+// mode keeps only whether the file is executable
+func (n *normalization) mode(mode os.FileMode) os.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
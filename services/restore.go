@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/models"
+)
+
+// maxLinkTarget limits how much of a zip symlink entry is read as its target
+const maxLinkTarget = 4096
+
+// errNotDir is returned when a directory was replaced by a link or a file
+var errNotDir = errors.New("not a directory")
+
+// restorer writes planned entries to disk and restores their metadata
+type restorer struct {
+	logger        *slog.Logger
+	skipOwnership bool
+	targetDir     string
+	strip         int
+	planned       map[int]*plannedEntry
+	paths         map[string]string
+	dirs          []*plannedEntry
+}
+
+func newRestorer(ctx context.Context, req *models.Request, plan []plannedEntry) *restorer {
+	r := &restorer{
+		logger:        logging.Logger(ctx),
+		skipOwnership: req.SkipOwnership,
+		targetDir:     req.TargetDir(),
+		strip:         req.StripComponents,
+		planned:       make(map[int]*plannedEntry, len(plan)),
+		paths:         make(map[string]string, len(plan)),
+	}
+	for i := range plan {
+		r.planned[plan[i].entry.index] = &plan[i]
+		if plan[i].result.Action != models.OutcomeSkipped {
+			r.paths[plan[i].entry.name] = plan[i].result.Path
+		}
+	}
+	return r
+}
+
+// write extracts the entry if it was planned
+func (r *restorer) write(entry *archiveEntry, content io.Reader) error {
+	planned, ok := r.planned[entry.index]
+	if !ok {
+		return nil
+	}
+	path := planned.result.Path
+	if entry.isDir() {
+		if err := checkContained(r.targetDir, path); err != nil {
+			return err
+		}
+		r.logger.Debug("directory created", "path", path)
+		r.dirs = append(r.dirs, planned)
+		return os.MkdirAll(path, dirMode())
+	}
+	if planned.result.Action == models.OutcomeSkipped {
+		r.logger.Debug("file skipped", "entry", entry.name)
+		return nil
+	}
+
+	// links extracted earlier must not redirect the entry out of the destination
+	if err := checkContained(r.targetDir, filepath.Dir(path)); err != nil {
+		return err
+	}
+	r.logger.Debug("file extracted", "entry", entry.name)
+	// parent directory entries may have been filtered out
+	if err := os.MkdirAll(filepath.Dir(path), dirMode()); err != nil {
+		return err
+	}
+	// never write through an existing link, nor replace a directory
+	if info, err := os.Lstat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("failed to extract %s: a directory exists at %s", entry.name, path)
+		}
+		if info.Mode()&os.ModeSymlink != 0 || entry.hardlink || entry.isSymlink() {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	var err error
+	switch {
+	case entry.hardlink:
+		err = r.writeHardlink(entry, path)
+	case entry.isSymlink():
+		err = writeSymlink(entry, content, path)
+	default:
+		err = writeFile(entry, content, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %s", entry.name, err)
+	}
+	return r.restoreMetadata(entry, path)
+}
+
+// finish restores directory metadata once their content is written
+func (r *restorer) finish() error {
+	for i := len(r.dirs) - 1; i >= 0; i-- {
+		if err := r.restoreDirMetadata(r.dirs[i].entry, r.dirs[i].result.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreDirMetadata applies the metadata through the open directory, so a link put in its place is never followed
+func (r *restorer) restoreDirMetadata(entry *archiveEntry, path string) error {
+	if err := checkContained(r.targetDir, filepath.Dir(path)); err != nil {
+		return err
+	}
+	dir, err := openDir(path)
+	if errors.Is(err, errNotDir) {
+		r.logger.Warn("directory metadata not restored", "path", path, "err", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if entry.hasOwner && !r.skipOwnership {
+		if err := dir.Chown(entry.uid, entry.gid); err != nil {
+			r.logger.Warn("ownership not restored", "path", path, "err", err)
+		}
+	}
+	if mode := entry.mode.Perm(); mode != 0 {
+		if err := dir.Chmod(mode); err != nil {
+			return err
+		}
+	}
+	if !entry.modified.IsZero() {
+		if err := setModTime(dir, entry.modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *restorer) writeHardlink(entry *archiveEntry, path string) error {
+	source, ok := r.paths[entry.linkname]
+	if !ok {
+		source = filepath.Join(r.targetDir, filepath.FromSlash(stripComponents(entry.linkname, r.strip)))
+	}
+	if err := checkContained(r.targetDir, filepath.Dir(source)); err != nil || !isWithin(r.targetDir, source) {
+		return fmt.Errorf("hardlink to %s escapes the destination", entry.linkname)
+	}
+	// link(2) does not follow symlinks, a link to one would carry later metadata outside
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("hardlink to %s is not a regular file", entry.linkname)
+	}
+	return os.Link(source, path)
+}
+
+func writeSymlink(entry *archiveEntry, content io.Reader, path string) error {
+	target := entry.linkname
+	if target == "" {
+		// zip stores the link target as the entry content
+		data, err := io.ReadAll(io.LimitReader(content, maxLinkTarget))
+		if err != nil {
+			return err
+		}
+		target = string(data)
+	}
+	if target == "" {
+		return errors.New("empty symlink target")
+	}
+	return os.Symlink(target, path)
+}
+
+func writeFile(entry *archiveEntry, content io.Reader, path string) error {
+	outputFile, err := os.OpenFile(
+		path,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		entry.mode.Perm(),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(outputFile, content); err != nil {
+		_ = outputFile.Close()
+		return err
+	}
+	return outputFile.Close()
+}
+
+// restoreMetadata applies the mode, ownership and modification time of the entry,
+// setuid, setgid and sticky bits of untrusted archives are dropped
+func (r *restorer) restoreMetadata(entry *archiveEntry, path string) error {
+	if entry.hasOwner && !r.skipOwnership {
+		// ownership is only restored where the service user is allowed to
+		if err := os.Lchown(path, entry.uid, entry.gid); err != nil {
+			r.logger.Warn("ownership not restored", "path", path, "err", err)
+		}
+	}
+	// chmod and chtimes follow symlinks, whatever the entry claims to be
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if entry.isSymlink() || info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	if mode := entry.mode.Perm(); mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if !entry.modified.IsZero() {
+		if err := os.Chtimes(path, entry.modified, entry.modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// ErrOutsideRoots is returned for paths that resolve outside the allowed roots
+var ErrOutsideRoots = errors.New("path is outside the allowed roots")
+
+// CheckRoots rejects requests whose paths resolve outside the allowed roots of the tenant
+func CheckRoots(req *models.Request) error {
+	roots := tenantRoots(req.Tenant)
+	if len(roots) == 0 {
+		return nil
+	}
+	paths := []string{req.Dir, req.ArchivePath()}
+	if req.Destination != "" {
+		paths = append(paths, req.Destination)
+	}
+	if req.Output != "" {
+		paths = append(paths, req.Output)
+	}
+	for _, path := range paths {
+		resolved, err := resolvePath(path)
+		if err != nil || !underRoots(resolved, roots) {
+			return fmt.Errorf("%w: %s", ErrOutsideRoots, path)
+		}
+	}
+	return nil
+}
+
+// tenantRoots confines a tenant to its own directory under TENANTS_DIR, other callers to the allowed roots.
+// Only admins reach it without a tenant once TENANTS_DIR is set, Require rejects the other callers.
+func tenantRoots(tenant string) []string {
+	base := os.Getenv("TENANTS_DIR")
+	if tenant == "" || base == "" {
+		return allowedRoots()
+	}
+	root := filepath.Join(base, tenant)
+	if resolved, err := resolvePath(root); err == nil {
+		root = resolved
+	}
+	return []string{root}
+}
+
+// allowedRoots returns the resolved ALLOWED_ROOTS, empty when access is unrestricted
+func allowedRoots() []string {
+	var roots []string
+	for _, root := range filepath.SplitList(os.Getenv("ALLOWED_ROOTS")) {
+		if root == "" {
+			continue
+		}
+		if resolved, err := resolvePath(root); err == nil {
+			root = resolved
+		}
+		roots = append(roots, filepath.Clean(root))
+	}
+	return roots
+}
+
+// CheckStorage checks files can be created in every allowed root and in TENANTS_DIR
+func CheckStorage() error {
+	roots := allowedRoots()
+	if base := os.Getenv("TENANTS_DIR"); base != "" {
+		roots = append(roots, base)
+	}
+	for _, root := range roots {
+		file, err := os.CreateTemp(root, ".readyz-*")
+		if err != nil {
+			return fmt.Errorf("%s is not writable: %w", root, err)
+		}
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+	return nil
+}
+
+// resolvePath follows the symlinks of the existing part of the path so links cannot hide where it leads
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	missing := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// a dangling link would be followed once the missing part is created
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", fmt.Errorf("dangling symlink %s", path)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = parent
+	}
+}
+
+// underRoots check if the resolved path is one of the roots or inside one
+func underRoots(path string, roots []string) bool {
+	for _, root := range roots {
+		if isWithin(root, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin check if the path is the dir or inside it
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// linkAllowed check if a symlink that will be followed stays under the roots of the tenant
+func linkAllowed(path string, tenant string) bool {
+	roots := tenantRoots(tenant)
+	if len(roots) == 0 {
+		return true
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	return err == nil && underRoots(resolved, roots)
+}
+
+// checkContained check if the directory stays in the target directory once symlinks are resolved
+func checkContained(targetDir, dir string) error {
+	target, err := resolvePath(targetDir)
+	if err != nil {
+		return err
+	}
+	resolved, err := resolvePath(dir)
+	if err != nil {
+		return err
+	}
+	if !isWithin(target, resolved) {
+		return fmt.Errorf("%s escapes the destination", dir)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// resolveSecret reads the secret with the id from SECRETS_DIR so it never travels in a request or the database
+func resolveSecret(id string) ([]byte, error) {
+	if !models.ValidSecretID(id) {
+		return nil, errors.New("invalid secret id")
+	}
+	dir := os.Getenv("SECRETS_DIR")
+	if dir == "" {
+		return nil, errors.New("no secrets directory configured")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %s", id, err)
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return nil, fmt.Errorf("secret %s is empty", id)
+	}
+	return []byte(secret), nil
+}
+
+// archivePassword resolves the password of the request, returning nil when none is set
+func archivePassword(req *models.Request) ([]byte, error) {
+	if req.PasswordSecret == "" {
+		return nil, nil
+	}
+	return resolveSecret(req.PasswordSecret)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// signatureSuffix is appended to the archive path for detached signatures
+const signatureSuffix = ".sig"
+
+// signingKey is the Ed25519 key archives are signed with
+type signingKey struct {
+	id      string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+var (
+	loadKeyOnce sync.Once
+	loadedKey   *signingKey
+	loadKeyErr  error
+)
+
+// loadSigningKey reads the PKCS#8 PEM key from SIGNING_KEY_FILE once, returning nil when signing is disabled
+func loadSigningKey() (*signingKey, error) {
+	loadKeyOnce.Do(func() {
+		path := os.Getenv("SIGNING_KEY_FILE")
+		if path == "" {
+			return
+		}
+		loadedKey, loadKeyErr = readSigningKey(path)
+	})
+	return loadedKey, loadKeyErr
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %s", err)
+	}
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an Ed25519 key")
+	}
+	public := private.Public().(ed25519.PublicKey)
+	sum := sha256.Sum256(public)
+	return &signingKey{
+		id:      hex.EncodeToString(sum[:8]),
+		private: private,
+		public:  public,
+	}, nil
+}
+
+// fileDigest512 hashes the file for Ed25519ph so large archives are not held in memory
+func fileDigest512(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha512.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// signArchive writes a base64 Ed25519ph signature of the archive next to it
+func signArchive(key *signingKey, path string) error {
+	digest, err := fileDigest512(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash archive for signing: %s", err)
+	}
+	sig, err := key.private.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return fmt.Errorf("failed to sign archive: %s", err)
+	}
+
+	file, err := os.OpenFile(path+signatureSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open signature for writing: %s", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(base64.StdEncoding.EncodeToString(sig) + "\n"); err != nil {
+		return fmt.Errorf("failed to write signature: %s", err)
+	}
+	return file.Sync()
+}
+
+// verifySignature checks the detached signature of the archive
+func verifySignature(key *signingKey, path string) error {
+	data, err := os.ReadFile(path + signatureSuffix)
+	if err != nil {
+		return errors.New("archive signature is missing")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return errors.New("archive signature is malformed")
+	}
+	digest, err := fileDigest512(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash archive for verification: %s", err)
+	}
+	if err := ed25519.VerifyWithOptions(key.public, digest, sig, &ed25519.Options{Hash: crypto.SHA512}); err != nil {
+		return errors.New("archive signature does not verify")
+	}
+	return nil
+}
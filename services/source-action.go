@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// verifyArchive re-reads the archive, checking every expected entry is present and zip CRCs match
+func verifyArchive(req *models.Request, files []models.File) error {
+	read, err := openArchive(req)
+	if err != nil {
+		return fmt.Errorf("failed to open archive for verification: %s", err)
+	}
+	defer read.Close()
+
+	entries := make(map[string]bool, len(read.entries()))
+	for _, entry := range read.entries() {
+		entries[entry.name] = true
+	}
+	for _, file := range files {
+		if !entries[file.Name] {
+			return fmt.Errorf("verification failed: %s missing from archive", file.Name)
+		}
+	}
+
+	// reading every entry to the end makes the zip reader check its CRC
+	return read.walk(func(entry *archiveEntry, content io.Reader) error {
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return fmt.Errorf("verification failed for %s: %s", entry.name, err)
+		}
+		return nil
+	})
+}
+
+// errSourceChanged is returned when a file no longer matches what was archived
+var errSourceChanged = errors.New("changed since it was archived")
+
+// applySourceAction deletes or truncates the archived files and records each one,
+// files that changed after they were archived are left in place and recorded as changed
+func (a *ArchiveService) applySourceAction(ctx context.Context, req *models.Request) error {
+	for i := range req.Files {
+		file := &req.Files[i]
+		path := filepath.Join(req.Dir, filepath.FromSlash(file.Name))
+		var err error
+		switch req.SourceAction {
+		case models.SourceDelete:
+			err = deleteSource(req, path, *file)
+		case models.SourceTruncate:
+			err = truncateSource(path, *file)
+		default:
+			return errors.New("invalid source action")
+		}
+		switch {
+		case errors.Is(err, errSourceChanged):
+			slog.WarnContext(ctx, "source file left in place", "file", file.Name, "err", err)
+			file.Action = models.SourceChanged
+		case err != nil:
+			return fmt.Errorf("failed to %s %s: %s", req.SourceAction, file.Name, err)
+		default:
+			file.Action = req.SourceAction
+		}
+		if err := a.insertSource(ctx, req.ID, *file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSource removes the file when it is still the one archived, tar stores links themselves and zip their target
+func deleteSource(req *models.Request, path string, file models.File) error {
+	stat := os.Stat
+	if req.Format() == models.FormatTar {
+		stat = os.Lstat
+	}
+	info, err := stat(path)
+	if err != nil {
+		return err
+	}
+	if err := unchanged(info, file); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// truncateSource empties the file when it is still the one archived, checked on the open file
+func truncateSource(path string, file models.File) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := unchanged(info, file); err != nil {
+		return err
+	}
+	return f.Truncate(0)
+}
+
+// unchanged checks the size and modification time recorded when the file was archived
+func unchanged(info os.FileInfo, file models.File) error {
+	if file.ModTime.IsZero() || info.Size() != file.Size || !info.ModTime().Equal(file.ModTime) {
+		return errSourceChanged
+	}
+	return nil
+}
+
+func (a *ArchiveService) insertSource(ctx context.Context, archiveID string, file models.File) error {
+	query := `
+	INSERT INTO archive_sources(archiveId, fileName, size, action)
+	VALUES(?,?,?,?);
+	`
+	_, inserted := a.database.Insert(ctx, query, archiveID, file.Name, file.Size, file.Action)
+	if !inserted {
+		return errors.New("failed to insert archive source")
+	}
+	return nil
+}
+
+func (a *ArchiveService) getSources(ctx context.Context, archiveID string) ([]models.File, error) {
+	query := `
+	select fileName, size, action
+	from archive_sources
+	where archiveId = ?
+	order by id
+	`
+	rows, err := a.database.Query(ctx, query, archiveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.File{}
+	for rows.Next() {
+		var file models.File
+		if err := rows.Scan(&file.Name, &file.Size, &file.Action); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// tarReader reads tar archives, from the start on every pass
+type tarReader struct {
+	open func() (io.ReadCloser, error)
+	list []*archiveEntry
+}
+
+func openTarReader(path string) (*tarReader, error) {
+	return openTarStream(func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+}
+
+// openTarStream reads the tar archive produced by open, called again for every pass
+func openTarStream(open func() (io.ReadCloser, error)) (*tarReader, error) {
+	r := &tarReader{open: open}
+	err := r.scan(func(header *tar.Header, _ io.Reader) error {
+		r.list = append(r.list, tarEntry(len(r.list), header))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %s", err)
+	}
+	return r, nil
+}
+
+// tarEntry converts the tar header to an archive entry
+func tarEntry(index int, header *tar.Header) *archiveEntry {
+	info := header.FileInfo()
+	entry := &archiveEntry{
+		index:    index,
+		name:     header.Name,
+		mode:     info.Mode(),
+		modified: header.ModTime,
+		size:     header.Size,
+		uid:      header.Uid,
+		gid:      header.Gid,
+		hasOwner: true,
+		linkname: header.Linkname,
+	}
+	if header.Typeflag == tar.TypeLink {
+		entry.hardlink = true
+		entry.size = 0
+	}
+	return entry
+}
+
+// scan reads the archive from the start passing every header with its content
+func (r *tarReader) scan(fn func(header *tar.Header, content io.Reader) error) error {
+	file, err := r.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *tarReader) entries() []*archiveEntry {
+	return r.list
+}
+
+func (r *tarReader) walk(fn func(entry *archiveEntry, content io.Reader) error) error {
+	i := 0
+	return r.scan(func(_ *tar.Header, content io.Reader) error {
+		if i >= len(r.list) {
+			return errors.New("tar archive changed while reading")
+		}
+		entry := r.list[i]
+		i++
+		return fn(entry, content)
+	})
+}
+
+func (r *tarReader) Close() error {
+	return nil
+}
+
+// tarWriter writes tar archives keeping times, modes, ownership and links
+type tarWriter struct {
+	tw      *tar.Writer
+	links   map[fileIdentity]string
+	digests map[string]string
+	norm    *normalization
+	digest  bool
+}
+
+func newTarWriter(w io.Writer, norm *normalization, digest bool) *tarWriter {
+	return &tarWriter{
+		tw:      tar.NewWriter(w),
+		links:   make(map[fileIdentity]string),
+		digests: make(map[string]string),
+		norm:    norm,
+		digest:  digest,
+	}
+}
+
+func (t *tarWriter) add(dir string, file *models.File) error {
+	filename := file.Name
+	fileLoc := filepath.Join(dir, filepath.FromSlash(filename))
+	info, err := os.Lstat(fileLoc)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %s", filename, err)
+	}
+
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(fileLoc); err != nil {
+			return fmt.Errorf("failed to read link %s: %s", filename, err)
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("failed to create header for %s: %s", filename, err)
+	}
+	header.Name = filename
+	file.Size, file.ModTime = info.Size(), info.ModTime()
+	// pax keeps sub-second modification times
+	header.Format = tar.FormatPAX
+	if t.norm != nil {
+		t.normalize(header)
+	}
+
+	// later names of an already stored inode become hard links
+	if id, ok := identityOf(info); ok && info.Mode().IsRegular() {
+		if first, seen := t.links[id]; seen {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+		} else {
+			t.links[id] = filename
+		}
+	}
+
+	if err := t.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to create entry for %s in tar file: %s", filename, err)
+	}
+	if header.Typeflag == tar.TypeLink {
+		file.SHA256 = t.digests[header.Linkname]
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	f, err := os.Open(fileLoc)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %s", filename, err)
+	}
+	defer f.Close()
+	if err := copyContent(t.tw, f, file, t.digest); err != nil {
+		return fmt.Errorf("failed to write %s to tar: %s", filename, err)
+	}
+	t.digests[filename] = file.SHA256
+	return nil
+}
+
+func (t *tarWriter) addData(name string, data []byte) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  dataModTime(t.norm),
+	}
+	if t.norm == nil {
+		header.Format = tar.FormatPAX
+	}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to create entry for %s in tar file: %s", name, err)
+	}
+	_, err := t.tw.Write(data)
+	return err
+}
+
+// normalize drops ownership and access times and stamps the epoch
+func (t *tarWriter) normalize(header *tar.Header) {
+	if header.Typeflag != tar.TypeSymlink {
+		header.Mode = int64(t.norm.mode(os.FileMode(header.Mode)))
+	}
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+	header.ModTime = t.norm.epoch
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.PAXRecords = nil
+	header.Format = tar.FormatUnknown
+}
+
+func (t *tarWriter) Close() error {
+	return t.tw.Close()
+}
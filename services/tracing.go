@@ -0,0 +1,16 @@
+package services
+
+import (
+	"github.com/greatfocus/archive-service/models"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// jobAttributes describe the job on the spans of the services
+func jobAttributes(req *models.Request) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("job.id", req.ID),
+		attribute.String("job.format", req.Format()),
+		attribute.Bool("job.background", req.Background),
+		attribute.String("job.tenant", req.Tenant),
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/logging"
+	"github.com/greatfocus/archive-service/metrics"
+	"github.com/greatfocus/archive-service/models"
+	"github.com/greatfocus/archive-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrUnknownArchive is returned when the archive to verify against does not belong to the tenant
+var ErrUnknownArchive = errors.New("archive not found")
+
+// VerifyService struct
+type VerifyService struct {
+	database *database.Conn
+}
+
+// Init method
+func (v *VerifyService) Init(db *database.Conn) {
+	v.database = db
+}
+
+// CreateVerify test-reads the archive and records the result
+func (v *VerifyService) CreateVerify(ctx context.Context, req *models.Request) (*models.Request, error) {
+	req.ID = uuid.New().String()
+	if err := v.checkArchive(ctx, req); err != nil {
+		return req, err
+	}
+	if err := v.run(ctx, req); err != nil {
+		return req, err
+	}
+	req.Status = "done"
+	if err := v.insertRecordToDB(ctx, req); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// checkArchive refuses an archiveId the tenant does not own, its recorded entries would leak to the caller
+func (v *VerifyService) checkArchive(ctx context.Context, req *models.Request) error {
+	if req.ArchiveID == "" {
+		return nil
+	}
+	query := `
+	select count(*)
+	from archive
+	where id = ? and (? = '' or tenant = ?)
+	`
+	var found int
+	if err := v.database.Select(ctx, query, req.ArchiveID, req.Tenant, req.Tenant).Scan(&found); err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrUnknownArchive
+	}
+	return nil
+}
+
+// VerifyArchive re-verifies an archive produced by the service and flags corruption
+func (v *VerifyService) VerifyArchive(ctx context.Context, archive *models.Request) (*models.Request, error) {
+	req := &models.Request{
+		ID:             uuid.New().String(),
+		ArchiveID:      archive.ID,
+		File:           archive.File,
+		Dir:            archive.Dir,
+		Output:         archive.Output,
+		Aligorithm:     archive.Aligorithm,
+		PasswordSecret: archive.PasswordSecret,
+		Tenant:         archive.Tenant,
+	}
+	if err := v.run(ctx, req); err != nil {
+		return req, err
+	}
+	req.Status = "done"
+	if err := v.insertRecordToDB(ctx, req); err != nil {
+		return req, err
+	}
+
+	query := `
+	UPDATE archive SET integrity=?, verifiedOn=CURRENT_TIMESTAMP WHERE id=?;
+	`
+	if !v.database.Update(ctx, query, req.Integrity, archive.ID) {
+		return req, errors.New("failed to update archive integrity")
+	}
+	return req, nil
+}
+
+// run verifies the archive and records the job metrics
+func (v *VerifyService) run(ctx context.Context, req *models.Request) error {
+	ctx = logging.WithJobID(ctx, req.ID)
+	ctx, span := tracing.Start(ctx, "VerifyService.verify", jobAttributes(req)...)
+	metrics.JobCreated("verify", req.Format())
+	start := time.Now()
+	err := v.verify(ctx, req)
+	metrics.JobFinished("verify", req.Format(), start, err)
+	span.SetAttributes(attribute.String("verify.integrity", req.Integrity))
+	tracing.End(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "verification failed", "err", err)
+		return err
+	}
+	metrics.Transferred("verify", archiveSize(req), 0)
+	slog.InfoContext(ctx, "verification finished", "archive_id", req.ArchiveID, "integrity", req.Integrity, "checked", req.Checked)
+	return nil
+}
+
+// verify reads every entry, letting zip check CRCs, and compares the sha256 with the manifest
+func (v *VerifyService) verify(ctx context.Context, req *models.Request) error {
+	req.Integrity = models.IntegrityOK
+	req.Checked = 0
+	req.Failures = nil
+
+	read, err := openArchive(req)
+	if err != nil {
+		req.Integrity = models.IntegrityCorrupt
+		req.Failures = append(req.Failures, err.Error())
+		return nil
+	}
+	defer read.Close()
+
+	digests, err := v.expectedDigests(ctx, read, req)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(digests))
+	err = read.walk(func(entry *archiveEntry, content io.Reader) error {
+		req.Checked++
+		seen[entry.name] = true
+		h := sha256.New()
+		if _, err := io.Copy(h, content); err != nil {
+			req.Failures = append(req.Failures, fmt.Sprintf("%s: %s", entry.name, err))
+			return nil
+		}
+		// links carry no content of their own
+		if entry.hardlink || entry.isSymlink() {
+			return nil
+		}
+		expected, ok := digests[entry.name]
+		if ok && expected != hex.EncodeToString(h.Sum(nil)) {
+			req.Failures = append(req.Failures, fmt.Sprintf("%s: sha256 mismatch", entry.name))
+		}
+		return nil
+	})
+	if err != nil {
+		req.Failures = append(req.Failures, err.Error())
+	}
+	for name := range digests {
+		if !seen[name] {
+			req.Failures = append(req.Failures, fmt.Sprintf("%s: missing from archive", name))
+		}
+	}
+	if len(req.Failures) > 0 {
+		req.Integrity = models.IntegrityCorrupt
+	}
+	return nil
+}
+
+// expectedDigests prefers the digests recorded at archive time over the manifest inside the archive
+func (v *VerifyService) expectedDigests(ctx context.Context, read archiveReader, req *models.Request) (map[string]string, error) {
+	if req.ArchiveID != "" {
+		digests, err := v.getEntries(ctx, req.ArchiveID)
+		if err != nil || len(digests) > 0 {
+			return digests, err
+		}
+	}
+	digests, err := readManifest(read, req)
+	if errors.Is(err, errNoManifest) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		req.Failures = append(req.Failures, err.Error())
+		return map[string]string{}, nil
+	}
+	return digests, nil
+}
+
+func (v *VerifyService) getEntries(ctx context.Context, archiveID string) (map[string]string, error) {
+	query := `
+	select fileName, sha256
+	from archive_entries
+	where archiveId = ?
+	`
+	rows, err := v.database.Query(ctx, query, archiveID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	digests := make(map[string]string)
+	for rows.Next() {
+		var name, digest string
+		if err := rows.Scan(&name, &digest); err != nil {
+			return nil, err
+		}
+		digests[name] = digest
+	}
+	return digests, rows.Err()
+}
+
+func (v *VerifyService) insertRecordToDB(ctx context.Context, req *models.Request) error {
+	query := `
+	insert into verification (id, archiveId, fileName, dir, output, aligorithm, status, integrity, checked, failures, keyId, tenant)
+	VALUES(?,?,?,?,?,?,?,?,?,?,?,?);
+	`
+	_, inserted := v.database.Insert(ctx, query, req.ID, req.ArchiveID, req.File, req.Dir, req.Output, req.Aligorithm, req.Status, req.Integrity, req.Checked, req.Failures, req.KeyID, req.Tenant)
+	if !inserted {
+		return errors.New("failed to insert verification")
+	}
+	return nil
+}
+
+// GetStatus returns the verification when it belongs to the tenant, any verification for callers without a tenant
+func (v *VerifyService) GetStatus(ctx context.Context, id string, tenant string) (models.Request, error) {
+	query := `
+	select id, archiveId, fileName, dir, output, status, integrity, checked, failures, keyId, createdOn
+	from verification
+	where id = ? and (? = '' or tenant = ?)
+	`
+	row := v.database.Select(ctx, query, id, tenant, tenant)
+	result := models.Request{}
+	err := row.Scan(&result.ID, &result.ArchiveID, &result.File, &result.Dir, &result.Output, &result.Status, &result.Integrity, &result.Checked, &result.Failures, &result.KeyID, &result.CreatedOn)
+	switch err {
+	case sql.ErrNoRows:
+		return result, nil
+	case nil:
+		return result, nil
+	default:
+		return result, err
+	}
+}
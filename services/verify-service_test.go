@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testDB connects to a migrated database created in a temporary working directory
+func testDB(t *testing.T) *database.Conn {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	t.Setenv("DB_MaxLifetime", "1")
+	t.Setenv("DB_MaxIdleConns", "1")
+	t.Setenv("DB_MaxOpenConns", "1")
+	db := &database.Conn{}
+	db.Connect()
+	return db
+}
+
+// testArchive archives a directory holding the named file for the tenant
+func testArchive(t *testing.T, db *database.Conn, tenant string, name string) *models.Request {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("tenant data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archiveService := ArchiveService{}
+	archiveService.Init(db)
+	req := &models.Request{File: "/out.tar", Dir: dir, Tenant: tenant}
+	res, err := archiveService.CreateArchive(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestVerifyRejectsArchiveOfAnotherTenant(t *testing.T) {
+	db := testDB(t)
+	archived := testArchive(t, db, "team-b", "secret.txt")
+	verifyService := VerifyService{}
+	verifyService.Init(db)
+
+	// team-a verifies its own archive against the entries recorded for team-b
+	own := testArchive(t, db, "team-a", "mine.txt")
+	req := &models.Request{File: own.File, Dir: own.Dir, ArchiveID: archived.ID, Tenant: "team-a"}
+	res, err := verifyService.CreateVerify(context.Background(), req)
+	if !errors.Is(err, ErrUnknownArchive) {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownArchive)
+	}
+	if len(res.Failures) > 0 {
+		t.Errorf("failures leak the other archive: %v", res.Failures)
+	}
+
+	// the owner and a global admin may verify against it
+	for _, tenant := range []string{"team-b", ""} {
+		req := &models.Request{File: archived.File, Dir: archived.Dir, ArchiveID: archived.ID, Tenant: tenant}
+		res, err := verifyService.CreateVerify(context.Background(), req)
+		if err != nil {
+			t.Fatalf("tenant %q: %s", tenant, err)
+		}
+		if res.Integrity != models.IntegrityOK {
+			t.Errorf("tenant %q: integrity = %s, failures %v", tenant, res.Integrity, res.Failures)
+		}
+	}
+}
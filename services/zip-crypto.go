@@ -0,0 +1,426 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// WinZip AES entries are stored with method 99 and describe the real method in an extra field
+const (
+	zipMethodAES    = 99
+	aesExtraID      = 0x9901
+	extTimeExtraID  = 0x5455
+	aesMACLen       = 10
+	aesVerifierLen  = 2
+	aesIterations   = 1000
+	aesStrength256  = 3
+	zipCryptoHeader = 12
+	// zipFlagEncrypted and zipFlagDescriptor are general purpose flag bits
+	zipFlagEncrypted  = 0x1
+	zipFlagDescriptor = 0x8
+	zipFlagUTF8       = 0x800
+)
+
+var (
+	errWrongPassword = errors.New("wrong password")
+	errAuthFailed    = errors.New("authentication code mismatch")
+)
+
+func isEncrypted(file *zip.File) bool {
+	return file.Flags&zipFlagEncrypted != 0
+}
+
+// openEncrypted decrypts and decompresses a WinZip AES or ZipCrypto entry
+func openEncrypted(file *zip.File, password []byte) (io.ReadCloser, error) {
+	if password == nil {
+		return nil, fmt.Errorf("%s is encrypted and no password was given", file.Name)
+	}
+	raw, err := file.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	if file.Method == zipMethodAES {
+		return openAES(file, raw, password)
+	}
+	return openZipCrypto(file, raw, password)
+}
+
+// aesExtra is the content of the WinZip AES extra field
+type aesExtra struct {
+	version  uint16
+	strength byte
+	method   uint16
+}
+
+func (e aesExtra) keyLen() int {
+	return 8 + 8*int(e.strength)
+}
+
+func parseAESExtra(extra []byte) (aesExtra, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == aesExtraID && size == 7 {
+			e := aesExtra{
+				version:  binary.LittleEndian.Uint16(extra),
+				strength: extra[4],
+				method:   binary.LittleEndian.Uint16(extra[5:]),
+			}
+			if e.strength < 1 || e.strength > 3 {
+				return e, fmt.Errorf("unsupported aes strength %d", e.strength)
+			}
+			return e, nil
+		}
+		extra = extra[size:]
+	}
+	return aesExtra{}, errors.New("missing aes extra field")
+}
+
+func (e aesExtra) bytes() []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b, aesExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 7)
+	binary.LittleEndian.PutUint16(b[4:], e.version)
+	copy(b[6:], "AE")
+	b[8] = e.strength
+	binary.LittleEndian.PutUint16(b[9:], e.method)
+	return b
+}
+
+// aesKeys derives the encryption key, authentication key and password verifier with PBKDF2-HMAC-SHA1
+func aesKeys(password, salt []byte, keyLen int) ([]byte, []byte, []byte) {
+	key := pbkdf2.Key(password, salt, aesIterations, 2*keyLen+aesVerifierLen, sha1.New)
+	return key[:keyLen], key[keyLen : 2*keyLen], key[2*keyLen:]
+}
+
+// winzipCTR is AES in counter mode with the little endian counter starting at one used by WinZip
+type winzipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinzipCTR(key []byte) (*winzipCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &winzipCTR{block: block, pos: aes.BlockSize}, nil
+}
+
+func (c *winzipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+func openAES(file *zip.File, raw io.Reader, password []byte) (io.ReadCloser, error) {
+	extra, err := parseAESExtra(file.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file.Name, err)
+	}
+	saltLen := extra.keyLen() / 2
+	overhead := uint64(saltLen + aesVerifierLen + aesMACLen)
+	if file.CompressedSize64 < overhead {
+		return nil, fmt.Errorf("%s: truncated aes entry", file.Name)
+	}
+	header := make([]byte, saltLen+aesVerifierLen)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	encKey, authKey, verifier := aesKeys(password, header[:saltLen], extra.keyLen())
+	if !hmac.Equal(verifier, header[saltLen:]) {
+		return nil, fmt.Errorf("%s: %w", file.Name, errWrongPassword)
+	}
+	ctr, err := newWinzipCTR(encKey)
+	if err != nil {
+		return nil, err
+	}
+	data := &aesReader{
+		r:   io.LimitReader(raw, int64(file.CompressedSize64-overhead)),
+		raw: raw,
+		mac: hmac.New(sha1.New, authKey),
+		ctr: ctr,
+	}
+	// AE-2 leaves the crc empty and relies on the authentication code
+	return decompressEntry(file, extra.method, data, extra.version == 1)
+}
+
+// aesReader decrypts the entry and checks the authentication code once the data is consumed
+type aesReader struct {
+	r    io.Reader
+	raw  io.Reader
+	mac  hash.Hash
+	ctr  *winzipCTR
+	done bool
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	if a.done {
+		return 0, io.EOF
+	}
+	n, err := a.r.Read(p)
+	a.mac.Write(p[:n])
+	a.ctr.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		a.done = true
+		code := make([]byte, aesMACLen)
+		if _, err := io.ReadFull(a.raw, code); err != nil {
+			return n, err
+		}
+		if !hmac.Equal(code, a.mac.Sum(nil)[:aesMACLen]) {
+			return n, errAuthFailed
+		}
+	}
+	return n, err
+}
+
+// zipCryptoKeys is the state of the traditional PKWARE cipher
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, b := range password {
+		k.update(b)
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32.IEEETable[byte(k[0])^b] ^ k[0]>>8
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32.IEEETable[byte(k[2])^byte(k[1]>>24)] ^ k[2]>>8
+}
+
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i, c := range buf {
+		t := k[2] | 2
+		buf[i] = c ^ byte((t*(t^1))>>8)
+		k.update(buf[i])
+	}
+}
+
+func openZipCrypto(file *zip.File, raw io.Reader, password []byte) (io.ReadCloser, error) {
+	keys := newZipCryptoKeys(password)
+	header := make([]byte, zipCryptoHeader)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	keys.decrypt(header)
+	// the last header byte repeats the high byte of the crc, or of the time when sizes follow the data
+	check := byte(file.CRC32 >> 24)
+	if file.Flags&zipFlagDescriptor != 0 {
+		check = byte(file.ModifiedTime >> 8)
+	}
+	if header[zipCryptoHeader-1] != check {
+		return nil, fmt.Errorf("%s: %w", file.Name, errWrongPassword)
+	}
+	return decompressEntry(file, file.Method, &zipCryptoReader{r: raw, keys: keys}, true)
+}
+
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.keys.decrypt(p[:n])
+	return n, err
+}
+
+// decompressEntry inflates decrypted data and checks its integrity when the content ends
+func decompressEntry(file *zip.File, method uint16, data io.Reader, checkCRC bool) (io.ReadCloser, error) {
+	var content io.Reader
+	switch method {
+	case zip.Store:
+		content = data
+	case zip.Deflate:
+		content = flate.NewReader(data)
+	default:
+		return nil, fmt.Errorf("%s: %s", file.Name, zip.ErrAlgorithm)
+	}
+	return &checkedReader{
+		content:  content,
+		data:     data,
+		crc:      crc32.NewIEEE(),
+		want:     file.CRC32,
+		checkCRC: checkCRC,
+	}, nil
+}
+
+type checkedReader struct {
+	content  io.Reader
+	data     io.Reader
+	crc      hash.Hash32
+	want     uint32
+	checkCRC bool
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.content.Read(p)
+	c.crc.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+	// drain what the decompressor left so the authentication code is read
+	if _, err := io.Copy(io.Discard, c.data); err != nil {
+		return n, err
+	}
+	if c.checkCRC && c.crc.Sum32() != c.want {
+		return n, zip.ErrChecksum
+	}
+	return n, io.EOF
+}
+
+func (c *checkedReader) Close() error {
+	if closer, ok := c.content.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// writeAES stores an entry compressed with deflate and encrypted as WinZip AE-2 with a 256 bit key
+func writeAES(zipw *zip.Writer, header *zip.FileHeader, password []byte, stageDir string, write func(w io.Writer) error) error {
+	// the sizes precede the data so the encrypted content is staged first, next to the archive
+	tmp, err := os.CreateTemp(stageDir, ".archive-aes-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	extra := aesExtra{version: 2, strength: aesStrength256, method: zip.Deflate}
+	salt := make([]byte, extra.keyLen()/2)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	encKey, authKey, verifier := aesKeys(password, salt, extra.keyLen())
+	ctr, err := newWinzipCTR(encKey)
+	if err != nil {
+		return err
+	}
+	enc := &aesWriter{w: tmp, mac: hmac.New(sha1.New, authKey), ctr: ctr}
+	compressor, err := flate.NewWriter(enc, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	plain := &countWriter{w: compressor}
+	if err := write(plain); err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	header.Method = zipMethodAES
+	header.Flags |= zipFlagEncrypted
+	if !isASCII(header.Name) && utf8.ValidString(header.Name) {
+		header.Flags |= zipFlagUTF8
+	}
+	header.ReaderVersion = 51
+	header.CRC32 = 0
+	if !header.Modified.IsZero() {
+		header.SetModTime(header.Modified)
+	}
+	header.Extra = append(append(header.Extra, extTimeExtra(header)...), extra.bytes()...)
+	header.UncompressedSize64 = uint64(plain.n)
+	header.CompressedSize64 = uint64(len(salt)+len(verifier)+aesMACLen) + uint64(enc.n)
+
+	wr, err := zipw.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	for _, part := range []io.Reader{bytes.NewReader(salt), bytes.NewReader(verifier), tmp, bytes.NewReader(enc.mac.Sum(nil)[:aesMACLen])} {
+		if _, err := io.Copy(wr, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aesWriter encrypts and authenticates the compressed stream
+type aesWriter struct {
+	w   io.Writer
+	mac hash.Hash
+	ctr *winzipCTR
+	buf []byte
+	n   int64
+}
+
+func (a *aesWriter) Write(p []byte) (int, error) {
+	a.buf = append(a.buf[:0], p...)
+	a.ctr.XORKeyStream(a.buf, a.buf)
+	a.mac.Write(a.buf)
+	n, err := a.w.Write(a.buf)
+	a.n += int64(n)
+	return n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// extTimeExtra encodes the modification time as CreateHeader would, since raw entries skip it
+func extTimeExtra(header *zip.FileHeader) []byte {
+	if header.Modified.IsZero() {
+		return nil
+	}
+	b := make([]byte, 9)
+	binary.LittleEndian.PutUint16(b, extTimeExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 5)
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], uint32(header.Modified.Unix()))
+	return b
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Known answers computed independently with OpenSSL 3:
+//
+//	openssl kdf -keylen 66 -kdfopt digest:SHA1 -kdfopt pass:password \
+//	    -kdfopt hexsalt:000102030405060708090a0b0c0d0e0f -kdfopt iter:1000 PBKDF2
+//
+// the keystream by encrypting the little endian counters 1, 2, 3 with openssl enc -aes-256-ecb,
+// and the authentication code with openssl dgst -sha1 -mac HMAC over the ciphertext.
+const (
+	katPassword   = "password"
+	katSalt       = "000102030405060708090a0b0c0d0e0f"
+	katEncKey     = "0309e2fe4e0bdfe7d0fe4828d41c234416e2d9bfb61cdd8f643a11cfbfdfc119"
+	katAuthKey    = "e78b0eb3d9243415743b2fe4f5e67c6689bd2c3e512d0fda622dd7d1b0565b83"
+	katVerifier   = "256b"
+	katPlaintext  = "WinZip AE-2 known answer, three AES blocks!"
+	katCiphertext = "dcbda401b141b7e2086aa6a0d0cb5731434790a7bfae969338bad7855ed6adb23729d7dba1da1623c67776"
+	katMAC        = "eb0a63f1579c01ef710b07fbba825008d697ef68"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestAESKeysKnownAnswer(t *testing.T) {
+	encKey, authKey, verifier := aesKeys([]byte(katPassword), unhex(t, katSalt), 32)
+	for _, c := range []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"encryption key", encKey, katEncKey},
+		{"authentication key", authKey, katAuthKey},
+		{"password verifier", verifier, katVerifier},
+	} {
+		if hex.EncodeToString(c.got) != c.want {
+			t.Errorf("%s = %x, want %s", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestWinzipCTRKnownAnswer(t *testing.T) {
+	// the keystream must not depend on how the data is split
+	for _, chunk := range []int{1, 5, 16, 17, len(katPlaintext)} {
+		ctr, err := newWinzipCTR(unhex(t, katEncKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []byte(katPlaintext)
+		for i := 0; i < len(got); i += chunk {
+			end := i + chunk
+			if end > len(got) {
+				end = len(got)
+			}
+			ctr.XORKeyStream(got[i:end], got[i:end])
+		}
+		if hex.EncodeToString(got) != katCiphertext {
+			t.Errorf("chunks of %d: ciphertext = %x, want %s", chunk, got, katCiphertext)
+		}
+	}
+}
+
+// katZip stores the known answer as a stored AE-2 entry, with the authentication code as given
+func katZip(t *testing.T, mac []byte) *zip.File {
+	t.Helper()
+	extra := aesExtra{version: 2, strength: aesStrength256, method: zip.Store}
+	data := bytes.Join([][]byte{unhex(t, katSalt), unhex(t, katVerifier), unhex(t, katCiphertext), mac[:aesMACLen]}, nil)
+	header := &zip.FileHeader{
+		Name:               "kat.txt",
+		Method:             zipMethodAES,
+		Flags:              zipFlagEncrypted,
+		Extra:              extra.bytes(),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(katPlaintext)),
+	}
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	w, err := zipw.CreateRaw(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zipw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	read, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read.File[0]
+}
+
+func TestOpenAESKnownAnswer(t *testing.T) {
+	got, err := readEncrypted(katZip(t, unhex(t, katMAC)), katPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != katPlaintext {
+		t.Errorf("plaintext = %q, want %q", got, katPlaintext)
+	}
+
+	tampered := unhex(t, katMAC)
+	tampered[0] ^= 1
+	if _, err := readEncrypted(katZip(t, tampered), katPassword); !errors.Is(err, errAuthFailed) {
+		t.Errorf("tampered authentication code: err = %v, want %v", err, errAuthFailed)
+	}
+	if _, err := readEncrypted(katZip(t, unhex(t, katMAC)), "wrong"); !errors.Is(err, errWrongPassword) {
+		t.Errorf("wrong password: err = %v, want %v", err, errWrongPassword)
+	}
+}
+
+// bigFixture is the content of big.txt in the fixtures
+func bigFixture() string {
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, "line %d of a file that deflates well\n", i)
+	}
+	return b.String()
+}
+
+// The fixtures were written by other tools, with the password "correct horse":
+//
+//	bsdtar --format zip --options zip:encryption=aes256 --passphrase 'correct horse' -cf aes256-libarchive.zip hello.txt big.txt
+//	zip -P 'correct horse' zipcrypto-infozip.zip hello.txt big.txt
+func TestOpenEncryptedFixtures(t *testing.T) {
+	want := map[string]string{
+		"hello.txt": "hello from libarchive\n",
+		"big.txt":   bigFixture(),
+	}
+	for _, name := range []string{"aes256-libarchive.zip", "zipcrypto-infozip.zip"} {
+		t.Run(name, func(t *testing.T) {
+			read, err := zip.OpenReader("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer read.Close()
+			if len(read.File) != len(want) {
+				t.Fatalf("%d entries, want %d", len(read.File), len(want))
+			}
+			for _, file := range read.File {
+				got, err := readEncrypted(file, "correct horse")
+				if err != nil {
+					t.Fatalf("%s: %s", file.Name, err)
+				}
+				if got != want[file.Name] {
+					t.Errorf("%s: content differs from the original", file.Name)
+				}
+				if _, err := readEncrypted(file, "wrong horse"); err == nil {
+					t.Errorf("%s: opened with a wrong password", file.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteAESRoundTrip(t *testing.T) {
+	stageDir := t.TempDir()
+	content := bigFixture()
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	header := &zip.FileHeader{Name: "big.txt"}
+	err := writeAES(zipw, header, []byte("secret"), stageDir, func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zipw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if staged, _ := os.ReadDir(stageDir); len(staged) != 0 {
+		t.Errorf("%d staged files left behind", len(staged))
+	}
+
+	read, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readEncrypted(read.File[0], "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != content {
+		t.Error("content differs after the round trip")
+	}
+}
+
+func readEncrypted(file *zip.File, password string) (string, error) {
+	content, err := openEncrypted(file, []byte(password))
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	return string(data), err
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/greatfocus/archive-service/models"
+)
+
+// zipReader reads zip archives
+type zipReader struct {
+	file     *os.File
+	staged   bool
+	read     *zip.Reader
+	list     []*archiveEntry
+	password []byte
+}
+
+func openZipReader(path string, password []byte) (*zipReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %s", err)
+	}
+	return openZipFile(file, password)
+}
+
+// openZipFile reads the zip archive in the open file, closed with the reader
+func openZipFile(file *os.File, password []byte) (*zipReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open file: %s", err)
+	}
+	read, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open file: %s", err)
+	}
+	r := &zipReader{file: file, read: read, password: password}
+	for i, file := range read.File {
+		r.list = append(r.list, &archiveEntry{
+			index:    i,
+			name:     file.Name,
+			mode:     file.Mode(),
+			modified: file.Modified,
+			size:     int64(file.UncompressedSize64),
+		})
+	}
+	return r, nil
+}
+
+func (r *zipReader) entries() []*archiveEntry {
+	return r.list
+}
+
+func (r *zipReader) walk(fn func(entry *archiveEntry, content io.Reader) error) error {
+	for i, file := range r.read.File {
+		if err := r.walkFile(file, r.list[i], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *zipReader) walkFile(file *zip.File, entry *archiveEntry, fn func(entry *archiveEntry, content io.Reader) error) error {
+	var content io.ReadCloser
+	var err error
+	if isEncrypted(file) {
+		content, err = openEncrypted(file, r.password)
+	} else {
+		content, err = file.Open()
+	}
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return fn(entry, content)
+}
+
+func (r *zipReader) Close() error {
+	err := r.file.Close()
+	if r.staged {
+		_ = os.Remove(r.file.Name())
+	}
+	return err
+}
+
+// zipWriter writes zip archives keeping modification times and unix modes, encrypting entries when a password is set
+type zipWriter struct {
+	zipw     *zip.Writer
+	norm     *normalization
+	digest   bool
+	password []byte
+	stageDir string
+}
+
+func newZipWriter(w io.Writer, norm *normalization, digest bool, password []byte, stageDir string) *zipWriter {
+	return &zipWriter{zipw: zip.NewWriter(w), norm: norm, digest: digest, password: password, stageDir: stageDir}
+}
+
+func (z *zipWriter) add(dir string, file *models.File) error {
+	filename := file.Name
+	fileLoc := filepath.Join(dir, filepath.FromSlash(filename))
+	// zip follows symlinks and stores the content of their target
+	info, err := os.Stat(fileLoc)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %s", filename, err)
+	}
+	content, err := os.Open(fileLoc)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %s", filename, err)
+	}
+	defer content.Close()
+	file.Size, file.ModTime = info.Size(), info.ModTime()
+
+	// the header carries the mtime as an extended timestamp and the unix mode
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("failed to create header for %s: %s", filename, err)
+	}
+	header.Name = filename
+	header.Method = zip.Deflate
+	if z.norm != nil {
+		z.normalize(header)
+	}
+
+	err = z.create(header, func(wr io.Writer) error {
+		return copyContent(wr, content, file, z.digest)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s to zip: %s", filename, err)
+	}
+	return nil
+}
+
+func (z *zipWriter) addData(name string, data []byte) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: dataModTime(z.norm),
+	}
+	header.SetMode(0644)
+	if z.norm != nil {
+		z.normalize(header)
+	}
+	err := z.create(header, func(wr io.Writer) error {
+		_, err := wr.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s to zip: %s", name, err)
+	}
+	return nil
+}
+
+// create adds the entry and lets write fill in its content
+func (z *zipWriter) create(header *zip.FileHeader, write func(wr io.Writer) error) error {
+	if z.password != nil {
+		return writeAES(z.zipw, header, z.password, z.stageDir, write)
+	}
+	wr, err := z.zipw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	return write(wr)
+}
+
+// normalize stamps the epoch as a plain dos time so no extended timestamp extra field is written
+func (z *zipWriter) normalize(header *zip.FileHeader) {
+	header.SetMode(z.norm.mode(header.Mode()))
+	header.Modified = time.Time{}
+	header.Extra = nil
+	epoch := z.norm.epoch
+	if epoch.Year() < 1980 {
+		// dos times start in 1980
+		epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	header.ModifiedDate = uint16((epoch.Year()-1980)<<9 | int(epoch.Month())<<5 | epoch.Day())
+	header.ModifiedTime = uint16(epoch.Hour()<<11 | epoch.Minute()<<5 | epoch.Second()>>1)
+}
+
+func (z *zipWriter) Close() error {
+	return z.zipw.Close()
+}
@@ -3,19 +3,28 @@ package task
 import (
 	"context"
 	"database/sql"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/greatfocus/archive-service/database"
+	"github.com/greatfocus/archive-service/logging"
 	"github.com/greatfocus/archive-service/models"
 	"github.com/greatfocus/archive-service/services"
+	"github.com/greatfocus/archive-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Tasks struct
 type Tasks struct {
 	archiveService *services.ArchiveService
 	extractService *services.ExtractService
+	verifyService  *services.VerifyService
 	database       *database.Conn
+
+	mu        sync.Mutex
+	startedOn time.Time
+	lastRuns  map[string]time.Time
 }
 
 // Init required parameters
@@ -26,32 +35,65 @@ func (t *Tasks) Init(db *database.Conn) {
 	t.extractService = &services.ExtractService{}
 	t.extractService.Init(db)
 
+	t.verifyService = &services.VerifyService{}
+	t.verifyService.Init(db)
+
 	t.database = db
+	t.startedOn = time.Now()
+	t.lastRuns = map[string]time.Time{}
+}
+
+// StartedOn returns when the scheduler was set up
+func (t *Tasks) StartedOn() time.Time {
+	return t.startedOn
+}
+
+// LastRuns returns when each task last started
+func (t *Tasks) LastRuns() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	runs := make(map[string]time.Time, len(t.lastRuns))
+	for name, at := range t.lastRuns {
+		runs[name] = at
+	}
+	return runs
+}
+
+func (t *Tasks) ran(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastRuns[name] = time.Now()
 }
 
 // ExtractBackgroundFile start the job to extract files in the background
 func (t *Tasks) ExtractBackgroundFile() {
-	log.Println("Scheduler_ExtractBackgroundFile started")
+	t.ran("extract")
+	slog.Debug("scheduler started", "task", "extract")
 	list, err := t.getBackgroundExtracts()
 	if err != nil {
-		log.Println("Scheduler_ExtractBackgroundFile failed to fetch archives")
+		slog.Error("scheduler failed to fetch jobs", "task", "extract", "err", err)
 		return
 	}
 	if len(list) > 0 {
 		t.extractBulk(list)
 	} else {
-		log.Println("Scheduler_ExtractBackgroundFile queued is empty")
+		slog.Debug("scheduler queue is empty", "task", "extract")
 	}
-	log.Println("Scheduler_ExtractBackgroundFile finished")
+	slog.Debug("scheduler finished", "task", "extract")
 }
 
 func (t *Tasks) extractBulk(list []models.Request) {
 	for i := 0; i < len(list); i++ {
 
 		go func(req *models.Request) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1)*time.Minute)
+			ctx, cancel := context.WithTimeout(jobContext(req), time.Duration(1)*time.Minute)
 			defer cancel()
-			t.extractService.InitiateExtract(ctx, req)
+			ctx, span := tracing.Start(ctx, "task.extract", attribute.String("job.id", req.ID))
+			_, err := t.extractService.InitiateExtract(ctx, req)
+			tracing.End(span, err)
+			if err != nil {
+				slog.ErrorContext(ctx, "background extract failed", "err", err)
+			}
 		}(&list[i])
 	}
 }
@@ -60,7 +102,7 @@ func (t *Tasks) getBackgroundExtracts() ([]models.Request, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1)*time.Minute)
 	defer cancel()
 	query := `
-	select id, fileName, dir, status, filteredNames, createdOn
+	select id, fileName, dir, destination, status, aligorithm, filteredNames, include, exclude, partialExtraction, onConflict, stripComponents, skipOwnership, verify, requireSignature, passwordSecret, tenant, traceParent, createdOn
 	from extract
 	where status = ? and background = ?
 	LIMIT 10;
@@ -69,7 +111,7 @@ func (t *Tasks) getBackgroundExtracts() ([]models.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	result, err := archiveMapper(rows)
+	result, err := extractMapper(rows)
 	if err != nil {
 		return nil, err
 	}
@@ -79,27 +121,33 @@ func (t *Tasks) getBackgroundExtracts() ([]models.Request, error) {
 
 // ArchiveBackgroundFile start the job to archive files in the background
 func (t *Tasks) ArchiveBackgroundFile() {
-	log.Println("Scheduler_ArchiveBackgroundFile started")
+	t.ran("archive")
+	slog.Debug("scheduler started", "task", "archive")
 	list, err := t.getBackgroundArchives()
 	if err != nil {
-		log.Println("Scheduler_ArchiveBackgroundFile failed to fetch archives")
+		slog.Error("scheduler failed to fetch jobs", "task", "archive", "err", err)
 		return
 	}
 	if len(list) > 0 {
 		t.archiveBulk(list)
 	} else {
-		log.Println("Scheduler_ArchiveBackgroundFile queued is empty")
+		slog.Debug("scheduler queue is empty", "task", "archive")
 	}
-	log.Println("Scheduler_ArchiveBackgroundFile finished")
+	slog.Debug("scheduler finished", "task", "archive")
 }
 
 func (t *Tasks) archiveBulk(list []models.Request) {
 	for i := 0; i < len(list); i++ {
 
 		go func(req *models.Request) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1)*time.Minute)
+			ctx, cancel := context.WithTimeout(jobContext(req), time.Duration(1)*time.Minute)
 			defer cancel()
-			t.archiveService.InitiateArchive(ctx, req)
+			ctx, span := tracing.Start(ctx, "task.archive", attribute.String("job.id", req.ID))
+			_, err := t.archiveService.InitiateArchive(ctx, req)
+			tracing.End(span, err)
+			if err != nil {
+				slog.ErrorContext(ctx, "background archive failed", "err", err)
+			}
 		}(&list[i])
 	}
 }
@@ -108,7 +156,7 @@ func (t *Tasks) getBackgroundArchives() ([]models.Request, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1)*time.Minute)
 	defer cancel()
 	query := `
-	select id, fileName, dir, status, filteredNames, createdOn
+	select id, fileName, dir, output, status, aligorithm, filteredNames, include, exclude, olderThan, newerThan, minSize, maxSize, sourceAction, reproducible, epoch, manifest, passwordSecret, encrypt, tenant, traceParent, createdOn
 	from archive
 	where status = ? and background = ?
 	LIMIT 10;
@@ -125,12 +173,87 @@ func (t *Tasks) getBackgroundArchives() ([]models.Request, error) {
 	return result, nil
 }
 
+// VerifyArchives re-verifies produced archives, oldest verification first
+func (t *Tasks) VerifyArchives() {
+	t.ran("verify")
+	slog.Debug("scheduler started", "task", "verify")
+	list, err := t.getArchivesToVerify()
+	if err != nil {
+		slog.Error("scheduler failed to fetch jobs", "task", "verify", "err", err)
+		return
+	}
+	for i := range list {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Minute)
+		ctx, span := tracing.Start(ctx, "task.verify", attribute.String("archive.id", list[i].ID))
+		res, err := t.verifyService.VerifyArchive(ctx, &list[i])
+		tracing.End(span, err)
+		ctx = logging.WithJobID(ctx, res.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "scheduled verification failed", "archive_id", list[i].ID, "err", err)
+		} else if res.Integrity == models.IntegrityCorrupt {
+			slog.WarnContext(ctx, "archive corrupt", "archive_id", list[i].ID, "failures", res.Failures)
+		}
+		cancel()
+	}
+	slog.Debug("scheduler finished", "task", "verify")
+}
+
+func (t *Tasks) getArchivesToVerify() ([]models.Request, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(1)*time.Minute)
+	defer cancel()
+	query := `
+	select id, fileName, dir, output, aligorithm, passwordSecret, tenant
+	from archive
+	where status = ?
+	order by verifiedOn is not null, verifiedOn
+	LIMIT 10;
+	`
+	rows, err := t.database.Query(ctx, query, "done")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.Request{}
+	for rows.Next() {
+		var channel models.Request
+		err := rows.Scan(&channel.ID, &channel.File, &channel.Dir, &channel.Output, &channel.Aligorithm, &channel.PasswordSecret, &channel.Tenant)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, channel)
+	}
+	return requests, nil
+}
+
+// jobContext continues the trace of the request that queued the job, with the job id on its log lines
+func jobContext(req *models.Request) context.Context {
+	return tracing.WithTraceParent(logging.WithJobID(context.Background(), req.ID), req.TraceParent)
+}
+
 // prepare row
 func archiveMapper(rows *sql.Rows) ([]models.Request, error) {
 	requests := []models.Request{}
 	for rows.Next() {
 		var channel models.Request
-		err := rows.Scan(&channel.ID, &channel.File, &channel.Dir, &channel.Status, &channel.FilteredNames, &channel.CreatedOn)
+		err := rows.Scan(&channel.ID, &channel.File, &channel.Dir, &channel.Output, &channel.Status, &channel.Aligorithm, &channel.FilteredNames, &channel.Include, &channel.Exclude,
+			&channel.OlderThan, &channel.NewerThan, &channel.MinSize, &channel.MaxSize, &channel.SourceAction, &channel.Reproducible, &channel.Epoch, &channel.Manifest, &channel.PasswordSecret, &channel.Encrypt, &channel.Tenant, &channel.TraceParent, &channel.CreatedOn)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, channel)
+	}
+
+	return requests, nil
+}
+
+// prepare row
+func extractMapper(rows *sql.Rows) ([]models.Request, error) {
+	requests := []models.Request{}
+	for rows.Next() {
+		var channel models.Request
+		err := rows.Scan(&channel.ID, &channel.File, &channel.Dir, &channel.Destination, &channel.Status, &channel.Aligorithm, &channel.FilteredNames, &channel.Include, &channel.Exclude,
+			&channel.PartialExtraction, &channel.OnConflict, &channel.StripComponents, &channel.SkipOwnership, &channel.Verify, &channel.RequireSignature, &channel.PasswordSecret, &channel.Tenant, &channel.TraceParent, &channel.CreatedOn)
 		if err != nil {
 			return nil, err
 		}
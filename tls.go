@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are checked for changes
+const certCheckInterval = 5 * time.Second
+
+// certReloader serves the configured certificate and client CA bundle, reloading them when the files change
+type certReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	minVersion uint16
+	clientAuth tls.ClientAuthType
+	base       *tls.Config
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	config    *tls.Config
+	stamp     string
+	checkedOn time.Time
+}
+
+// loadTLSConfig builds the server TLS config from TLS_CERT_FILE and TLS_KEY_FILE, nil when TLS is off
+func loadTLSConfig() (*tls.Config, error) {
+	r := &certReloader{
+		certFile: os.Getenv("TLS_CERT_FILE"),
+		keyFile:  os.Getenv("TLS_KEY_FILE"),
+		caFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+	if r.certFile == "" && r.keyFile == "" {
+		return nil, nil
+	}
+	if r.certFile == "" || r.keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	switch os.Getenv("TLS_MIN_VERSION") {
+	case "", "1.2":
+		r.minVersion = tls.VersionTLS12
+	case "1.3":
+		r.minVersion = tls.VersionTLS13
+	default:
+		return nil, errors.New("TLS_MIN_VERSION must be 1.2 or 1.3")
+	}
+
+	switch strings.ToLower(os.Getenv("TLS_CLIENT_AUTH")) {
+	case "", "require":
+		r.clientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		r.clientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, errors.New("TLS_CLIENT_AUTH must be require or optional")
+	}
+	if r.caFile == "" {
+		r.clientAuth = tls.NoClientCert
+	}
+
+	// the per client config is a copy of the base, so it keeps HTTP/2 and the certificate callback
+	r.base = &tls.Config{
+		MinVersion:         r.minVersion,
+		NextProtos:         []string{"h2", "http/1.1"},
+		GetCertificate:     r.getCertificate,
+		GetConfigForClient: r.getConfig,
+	}
+	cert, clientCAs, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.apply(cert, clientCAs)
+	r.stamp = r.fileStamp()
+	r.checkedOn = time.Now()
+	return r.base, nil
+}
+
+// getConfig returns the current config, reloading it first when the files changed
+func (r *certReloader) getConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	return r.config, nil
+}
+
+// getCertificate returns the current certificate, reloading it first when the files changed
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	return r.cert, nil
+}
+
+// reload loads the files again when they changed, it is called with r.mu held
+func (r *certReloader) reload() {
+	if time.Since(r.checkedOn) < certCheckInterval {
+		return
+	}
+	r.checkedOn = time.Now()
+	stamp := r.fileStamp()
+	if stamp == r.stamp {
+		return
+	}
+	cert, clientCAs, err := r.load()
+	if err != nil {
+		// keep serving the previous certificate until the files are valid again
+		slog.Error("TLS reload failed", "err", err)
+		return
+	}
+	slog.Info("TLS certificate reloaded")
+	r.apply(cert, clientCAs)
+	r.stamp = stamp
+}
+
+// apply derives the per client config from the base with the loaded certificate and client CAs
+func (r *certReloader) apply(cert *tls.Certificate, clientCAs *x509.CertPool) {
+	config := r.base.Clone()
+	config.GetConfigForClient = nil
+	config.ClientAuth = r.clientAuth
+	config.ClientCAs = clientCAs
+	r.cert = cert
+	r.config = config
+}
+
+func (r *certReloader) load() (*tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load TLS certificate: %s", err)
+	}
+	if r.caFile == "" {
+		return &cert, nil, nil
+	}
+	data, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read client CA bundle: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, nil, errors.New("client CA bundle holds no certificates")
+	}
+	return &cert, pool, nil
+}
+
+// fileStamp summarises the size and modification time of the files, following symlinks swapped on renewal
+func (r *certReloader) fileStamp() string {
+	var b strings.Builder
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}